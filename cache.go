@@ -0,0 +1,314 @@
+package scraper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPCache is an on-disk cache of GET responses for Session.Cache.
+// it is independent from the session directory of SaveToFile, and may be shared by several sessions.
+// a fresh response (Cache-Control max-age or Expires) is served without network access,
+// and a stale one is revalidated with If-None-Match/If-Modified-Since; a 304 response is
+// served from the cache as a normal *Response. responses with Cache-Control no-store are not stored.
+// as a shared cache of RFC 9111, responses with Cache-Control private or Set-Cookie are not stored,
+// and responses to requests with Authorization or cookies are stored and served only if
+// Cache-Control public, s-maxage or must-revalidate allows it.
+type HTTPCache struct {
+	Dir string // directory of cached responses
+
+	mu    sync.Mutex
+	stats CacheStats
+}
+
+// CacheStats holds counts of requests handled by HTTPCache.
+type CacheStats struct {
+	Hits        int // served from the cache without network access
+	Revalidated int // served from the cache after a 304 response
+	Misses      int // fetched from the network
+	Stored      int // responses stored to the cache
+}
+
+// cacheEntry is the metadata of a cached response, saved as <key>.json beside <key>.body.
+type cacheEntry struct {
+	URL        string            `json:"url"`
+	StatusCode int               `json:"status_code"`
+	Header     http.Header       `json:"header"`
+	Vary       map[string]string `json:"vary,omitempty"` // request headers named by the Vary response header
+	StoredAt   time.Time         `json:"stored_at"`
+}
+
+// NewHTTPCache creates an HTTPCache storing responses in dir.
+func NewHTTPCache(dir string) *HTTPCache {
+	return &HTTPCache{Dir: dir}
+}
+
+// Stats returns counts of requests handled by the cache.
+func (cache *HTTPCache) Stats() CacheStats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.stats
+}
+
+func (cache *HTTPCache) count(f func(stats *CacheStats)) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	f(&cache.stats)
+}
+
+func (cache *HTTPCache) filename(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL.String()))
+	return path.Join(cache.Dir, hex.EncodeToString(sum[:]))
+}
+
+// load returns the cached entry for req, or nil.
+func (cache *HTTPCache) load(req *http.Request, authenticated bool) *cacheEntry {
+	if req.Method != http.MethodGet || cacheControl(req.Header).has("no-store") {
+		return nil
+	}
+	data, err := os.ReadFile(cache.filename(req) + ".json")
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if json.Unmarshal(data, &entry) != nil {
+		return nil
+	}
+	if authenticated && !cacheControl(entry.Header).shared() {
+		return nil
+	}
+	for name, value := range entry.Vary {
+		if req.Header.Get(name) != value {
+			return nil
+		}
+	}
+	return &entry
+}
+
+// fresh reports whether entry can be served without revalidation at now.
+func (entry *cacheEntry) fresh(req *http.Request, now time.Time) bool {
+	if requestControl := cacheControl(req.Header); requestControl.has("no-cache") || req.Header.Get("Pragma") == "no-cache" {
+		return false
+	}
+	control := cacheControl(entry.Header)
+	if control.has("no-cache") {
+		return false
+	}
+	age := now.Sub(entry.StoredAt)
+	if seconds, err := strconv.Atoi(entry.Header.Get("Age")); err == nil {
+		age += time.Duration(seconds) * time.Second
+	}
+	if maxAge, ok := control.seconds("s-maxage"); ok {
+		return age < maxAge
+	}
+	if maxAge, ok := control.seconds("max-age"); ok {
+		return age < maxAge
+	}
+	if expires, err := http.ParseTime(entry.Header.Get("Expires")); err == nil {
+		date, err := http.ParseTime(entry.Header.Get("Date"))
+		if err != nil {
+			date = entry.StoredAt
+		}
+		return age < expires.Sub(date)
+	}
+	return false
+}
+
+// response returns a 200 response of entry with the cached body.
+func (cache *HTTPCache) response(req *http.Request, entry *cacheEntry) (*http.Response, error) {
+	body, err := os.ReadFile(cache.filename(req) + ".body")
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.StatusCode, http.StatusText(entry.StatusCode)),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        entry.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// store saves entry and body, replacing a previous response of req.
+func (cache *HTTPCache) store(req *http.Request, entry *cacheEntry, body []byte) error {
+	if err := os.MkdirAll(cache.Dir, os.FileMode(0755)); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	filename := cache.filename(req)
+	if body != nil {
+		if err := os.WriteFile(filename+".body", body, os.FileMode(0644)); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filename+".json", data, os.FileMode(0644))
+}
+
+// cacheable reports whether response can be stored in a shared cache, returning request headers it varies by.
+// authenticated tells the request was sent with Authorization or cookies.
+func cacheable(response *http.Response, authenticated bool) (map[string]string, bool) {
+	if response.Request.Method != http.MethodGet || response.StatusCode != http.StatusOK || response.Request.Response != nil {
+		return nil, false // redirected responses are not stored to keep cookies of the redirects
+	}
+	control := cacheControl(response.Header)
+	if control.has("no-store") || cacheControl(response.Request.Header).has("no-store") {
+		return nil, false
+	}
+	if control.has("private") || response.Header.Get("Set-Cookie") != "" || (authenticated && !control.shared()) {
+		return nil, false // the response is for the user of the session
+	}
+	var vary map[string]string
+	for _, value := range response.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				if vary == nil {
+					vary = map[string]string{}
+				}
+				vary[http.CanonicalHeaderKey(name)] = response.Request.Header.Get(name)
+			}
+		}
+	}
+	return vary, true
+}
+
+// cachedDo sends req with send through session.Cache.
+// a fresh cached response is returned without calling send.
+func (session *Session) cachedDo(req *http.Request, send func(req *http.Request) (*http.Response, error)) (*http.Response, error) {
+	cache := session.Cache
+	if cache == nil {
+		return send(req)
+	}
+	authenticated := req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != "" ||
+		(session.client.Jar != nil && len(session.client.Jar.Cookies(req.URL)) > 0)
+	entry := cache.load(req, authenticated)
+	if entry != nil && entry.fresh(req, time.Now()) {
+		if response, err := cache.response(req, entry); err == nil {
+			cache.count(func(stats *CacheStats) { stats.Hits++ })
+			session.Printf("%s CACHE HIT %v\n", session.getDebugPrefix(), session.Redactor.url(req.URL.String()))
+			return response, nil
+		}
+		entry = nil
+	}
+
+	// validators are not added if the caller set its own conditional headers
+	conditional := false
+	if entry != nil && req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+			conditional = true
+		}
+		if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+			conditional = true
+		}
+	}
+
+	response, err := send(req)
+	if err != nil {
+		return nil, err
+	}
+	if conditional && response.StatusCode == http.StatusNotModified {
+		// update the stored headers with the 304 response
+		for name, values := range response.Header {
+			if name != "Content-Length" {
+				entry.Header[name] = values
+			}
+		}
+		entry.StoredAt = time.Now()
+		cached, err := cache.response(req, entry)
+		if err == nil {
+			cached.Request = response.Request
+			_ = response.Body.Close()
+			_ = cache.store(req, entry, nil)
+			cache.count(func(stats *CacheStats) { stats.Revalidated++ })
+			session.Printf("%s CACHE REVALIDATED %v\n", session.getDebugPrefix(), session.Redactor.url(req.URL.String()))
+			return cached, nil
+		}
+	}
+
+	if req.Method == http.MethodGet {
+		cache.count(func(stats *CacheStats) { stats.Misses++ })
+	}
+	vary, ok := cacheable(response, authenticated)
+	if !ok {
+		return response, nil
+	}
+	body, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	entry = &cacheEntry{
+		URL:        req.URL.String(),
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+		Vary:       vary,
+		StoredAt:   time.Now(),
+	}
+	if err := cache.store(req, entry, body); err != nil {
+		session.Printf("%s CACHE store failed: %v\n", session.getDebugPrefix(), err)
+	} else {
+		cache.count(func(stats *CacheStats) { stats.Stored++ })
+	}
+	return response, nil
+}
+
+// cacheDirectives holds directives of Cache-Control headers by lower-cased names.
+type cacheDirectives map[string]string
+
+func cacheControl(header http.Header) cacheDirectives {
+	directives := cacheDirectives{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+func (directives cacheDirectives) has(name string) bool {
+	_, ok := directives[name]
+	return ok
+}
+
+// shared reports whether the response may be served to other users than the one who requested it.
+func (directives cacheDirectives) shared() bool {
+	return directives.has("public") || directives.has("s-maxage") || directives.has("must-revalidate")
+}
+
+func (directives cacheDirectives) seconds(name string) (time.Duration, bool) {
+	arg, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
@@ -0,0 +1,174 @@
+package scraper
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSession_Cache(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, fmt.Sprintf("%v %v", r.URL.Path, r.Header.Get("If-None-Match")+r.Header.Get("If-Modified-Since")))
+		switch r.URL.Path {
+		case "/etag":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+		case "/last-modified":
+			lastModified := "Mon, 01 Jan 2024 00:00:00 GMT"
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Last-Modified", lastModified)
+		case "/max-age":
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("ETag", `"v1"`)
+		}
+		fmt.Fprintf(w, "<html><body>%v</body></html>", r.URL.Path)
+	}))
+	defer ts.Close()
+
+	cache := NewHTTPCache(t.TempDir())
+	session := NewSession("cache", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	session.Cache = cache
+
+	for _, p := range []string{"/etag", "/last-modified", "/max-age", "/no-store"} {
+		for i := 0; i < 2; i++ {
+			resp, err := session.Get(ts.URL + p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusOK || !strings.Contains(string(resp.RawBody), p) {
+				t.Errorf("%v #%v: status %v, body %q", p, i, resp.StatusCode, resp.RawBody)
+			}
+		}
+	}
+	want := []string{
+		"/etag ", `/etag "v1"`,
+		"/last-modified ", "/last-modified Mon, 01 Jan 2024 00:00:00 GMT",
+		"/max-age ",
+		"/no-store ", "/no-store ",
+	}
+	if fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+	if stats, want := cache.Stats(), (CacheStats{Hits: 1, Revalidated: 2, Misses: 5, Stored: 3}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	// the cache is shared by another session, and no-cache forces revalidation
+	requests = nil
+	other := NewSession("cache_other", &BufferedLogger{})
+	other.FilePrefix = t.TempDir() + "/"
+	other.Cache = cache
+	other.Header = http.Header{"Cache-Control": {"no-cache"}}
+	if _, err := other.Get(ts.URL + "/max-age"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/max-age "}; fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+}
+
+func TestSession_CacheShared(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=3600")
+		case "/account", "/set-cookie":
+			w.Header().Set("Cache-Control", "max-age=3600")
+			if r.URL.Path == "/set-cookie" {
+				http.SetCookie(w, &http.Cookie{Name: "visited", Value: "1"})
+			}
+		case "/public":
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+		}
+		user := "guest"
+		if cookie, err := r.Cookie("SID"); err == nil {
+			user = cookie.Value
+		}
+		fmt.Fprintf(w, "<html><body>%v %v</body></html>", r.URL.Path, user)
+	}))
+	defer ts.Close()
+
+	cache := NewHTTPCache(t.TempDir())
+	newSession := func(name string, sid string) *Session {
+		session := NewSession(name, &BufferedLogger{})
+		session.FilePrefix = t.TempDir() + "/"
+		session.Cache = cache
+		if sid != "" {
+			session.SetCookies(mustParseURL(t, ts.URL), []*http.Cookie{{Name: "SID", Value: sid}})
+		}
+		return session
+	}
+	alice := newSession("alice", "alice")
+	bob := newSession("bob", "bob")
+	guest := newSession("guest", "")
+
+	get := func(session *Session, p string) string {
+		t.Helper()
+		resp, err := session.Get(ts.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(resp.RawBody)
+	}
+	for _, p := range []string{"/private", "/account", "/set-cookie", "/public"} {
+		get(alice, p)
+	}
+	if body := get(bob, "/account"); !strings.Contains(body, "bob") {
+		t.Errorf("bob got %q", body)
+	}
+	if body := get(guest, "/account"); !strings.Contains(body, "guest") {
+		t.Errorf("guest got %q", body)
+	}
+	get(guest, "/private")
+	get(guest, "/set-cookie")
+	get(bob, "/public")
+
+	want := []string{"/private", "/account", "/set-cookie", "/public", "/account", "/account", "/private", "/set-cookie"}
+	if fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Stored != 2 {
+		t.Errorf("stats = %+v, want 1 hit of /public and 2 stored", stats)
+	}
+}
+
+func TestCacheEntry_fresh(t *testing.T) {
+	stored := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	req := &http.Request{Header: http.Header{}}
+	tests := []struct {
+		header http.Header
+		after  time.Duration
+		want   bool
+	}{
+		{http.Header{"Cache-Control": {"max-age=60"}}, 30 * time.Second, true},
+		{http.Header{"Cache-Control": {"max-age=60"}}, 90 * time.Second, false},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Age": {"40"}}, 30 * time.Second, false},
+		{http.Header{"Cache-Control": {"no-cache, max-age=60"}}, 0, false},
+		{http.Header{"Cache-Control": {"max-age=3600, s-maxage=60"}}, 90 * time.Second, false},
+		{http.Header{"Date": {"Mon, 01 Jan 2024 00:00:00 GMT"}, "Expires": {"Mon, 01 Jan 2024 01:00:00 GMT"}}, 30 * time.Minute, true},
+		{http.Header{"Date": {"Mon, 01 Jan 2024 00:00:00 GMT"}, "Expires": {"Mon, 01 Jan 2024 01:00:00 GMT"}}, 2 * time.Hour, false},
+		{http.Header{"Expires": {"0"}}, 0, false},
+		{http.Header{"ETag": {`"v1"`}}, 0, false},
+	}
+	for _, tt := range tests {
+		entry := &cacheEntry{Header: tt.header, StoredAt: stored}
+		if got := entry.fresh(req, stored.Add(tt.after)); got != tt.want {
+			t.Errorf("fresh(%v after %v) = %v, want %v", tt.header, tt.after, got, tt.want)
+		}
+	}
+}
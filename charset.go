@@ -0,0 +1,297 @@
+package scraper
+
+import (
+	"bytes"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// EncodingSource tells how the encoding of a response was determined.
+// the encoding is UTF-8 if Encoding of Response or Page is nil, declared or detected unless EncodingSourceUnknown.
+type EncodingSource int
+
+const (
+	EncodingSourceUnknown     EncodingSource = iota // not determined yet, or no clue in the body (treated as UTF-8)
+	EncodingSourceForced                            // Response.Encoding set beforehand (e.g. Session.Encoding)
+	EncodingSourceBOM                               // byte order mark
+	EncodingSourceMeta                              // <meta charset> or <meta http-equiv="Content-Type"> in the body
+	EncodingSourceContentType                       // charset of the Content-Type header
+	EncodingSourceDetected                          // guessed from the bytes of the body (UTF-8 or Japanese encodings)
+)
+
+func (source EncodingSource) String() string {
+	switch source {
+	case EncodingSourceForced:
+		return "forced"
+	case EncodingSourceBOM:
+		return "BOM"
+	case EncodingSourceMeta:
+		return "meta"
+	case EncodingSourceContentType:
+		return "Content-Type"
+	case EncodingSourceDetected:
+		return "detected"
+	}
+	return "unknown"
+}
+
+// charsetAliases are charset labels used by Japanese sites but not in the WHATWG encoding labels.
+var charsetAliases = map[string]encoding.Encoding{
+	"cp932": japanese.ShiftJIS,
+}
+
+// lookupCharset returns the encoding of a charset label of the WHATWG Encoding Standard
+// and whether the label is known. the encoding is nil for UTF-8.
+func lookupCharset(charset string) (encoding.Encoding, bool) {
+	label := strings.ToLower(strings.Trim(strings.TrimSpace(charset), `"'`))
+	if label == "" {
+		return nil, false
+	}
+	if e, ok := charsetAliases[label]; ok {
+		return e, true
+	}
+	e, err := htmlindex.Get(label)
+	if err != nil {
+		return nil, false
+	}
+	if e == unicode.UTF8 {
+		return nil, true
+	}
+	return e, true
+}
+
+// sniffEncoding determines the encoding of body like the HTML encoding sniffing algorithm,
+// except that <meta> takes precedence over Content-Type as many Japanese sites declare a wrong charset in the header:
+// BOM, <meta> in the first 1024 bytes (then in the whole head), charset of contentType, and detection of UTF-8 and Japanese encodings.
+// <meta> is searched only in HTML (or untyped) bodies, and JSON without charset is UTF-8.
+// the encoding is nil for UTF-8.
+func sniffEncoding(body []byte, contentType string) (encoding.Encoding, EncodingSource) {
+	switch {
+	case bytes.HasPrefix(body, []byte("\xef\xbb\xbf")):
+		return nil, EncodingSourceBOM
+	case bytes.HasPrefix(body, []byte("\xfe\xff")):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), EncodingSourceBOM
+	case bytes.HasPrefix(body, []byte("\xff\xfe")):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), EncodingSourceBOM
+	}
+	mediaType := mediaTypeOf(contentType)
+	if isHTMLMediaType(mediaType) {
+		if e, ok := lookupMetaCharset(prescanCharset(body)); ok {
+			return e, EncodingSourceMeta
+		}
+		if len(body) > prescanLength && metaRegexp.Match(body) {
+			if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body)); err == nil {
+				if e, ok := lookupMetaCharset(getCharsetFromHead(doc)); ok {
+					return e, EncodingSourceMeta
+				}
+			}
+		}
+	}
+	if e, ok := lookupCharset(charsetFromContentType(contentType)); ok {
+		return e, EncodingSourceContentType
+	}
+	if isJSONMediaType(mediaType) {
+		return nil, EncodingSourceUnknown
+	}
+	if e, ok := detectJapaneseEncoding(body); ok {
+		return e, EncodingSourceDetected
+	}
+	return nil, EncodingSourceUnknown
+}
+
+// mediaTypeOf returns the lower-cased media type of contentType without parameters.
+func mediaTypeOf(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// isHTMLMediaType reports whether a body of mediaType may declare its charset by <meta>.
+func isHTMLMediaType(mediaType string) bool {
+	return mediaType == "" || mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// lookupMetaCharset is lookupCharset for <meta>, where UTF-16 means UTF-8
+// as the document is not in UTF-16 if it was parsed as ASCII.
+func lookupMetaCharset(charset string) (encoding.Encoding, bool) {
+	e, ok := lookupCharset(charset)
+	if name, err := htmlindex.Name(e); ok && e != nil && err == nil && strings.HasPrefix(name, "utf-16") {
+		return nil, true
+	}
+	return e, ok
+}
+
+// prescanLength is the length of the body searched for <meta> by prescanCharset.
+const prescanLength = 1024
+
+var metaRegexp = regexp.MustCompile(`(?i)<meta\b`)
+
+// prescanCharset returns the charset declared by <meta> in the first 1024 bytes of body, or "".
+func prescanCharset(body []byte) string {
+	if len(body) > prescanLength {
+		body = body[:prescanLength]
+	}
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != "meta" || !hasAttr {
+				continue
+			}
+			var charset, httpEquiv, content string
+			for more := true; more; {
+				var key, val []byte
+				key, val, more = z.TagAttr()
+				switch string(key) {
+				case "charset":
+					charset = string(val)
+				case "http-equiv":
+					httpEquiv = strings.ToLower(string(val))
+				case "content":
+					content = string(val)
+				}
+			}
+			if charset != "" {
+				return charset
+			}
+			if httpEquiv == "content-type" {
+				if charset = charsetFromContentType(content); charset != "" {
+					return charset
+				}
+			}
+		}
+	}
+}
+
+// detectLength is the length of the body examined by detectJapaneseEncoding.
+const detectLength = 64 * 1024
+
+// detectJapaneseEncoding guesses the encoding of an undeclared body:
+// UTF-8 (nil) if valid, ISO-2022-JP by its escape sequences, or Shift_JIS or EUC-JP by byte patterns.
+// returns false if body is ASCII only or does not look like any of them.
+func detectJapaneseEncoding(body []byte) (encoding.Encoding, bool) {
+	if len(body) > detectLength {
+		body = body[:detectLength]
+		// drop a character truncated at the end
+		for n := 1; n <= utf8.UTFMax && n <= len(body); n++ {
+			if utf8.RuneStart(body[len(body)-n]) {
+				if !utf8.FullRune(body[len(body)-n:]) {
+					body = body[:len(body)-n]
+				}
+				break
+			}
+		}
+	}
+	ascii := true
+	for _, c := range body {
+		if c >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		if bytes.Contains(body, []byte("\x1b$B")) || bytes.Contains(body, []byte("\x1b$@")) {
+			return japanese.ISO2022JP, true
+		}
+		return nil, false
+	}
+	if utf8.Valid(body) {
+		return nil, true
+	}
+
+	sjisErrors, sjisKana := scanShiftJIS(body)
+	eucErrors, eucKana := scanEUCJP(body)
+	switch {
+	case sjisErrors == 0 && (eucErrors > 0 || sjisKana >= eucKana):
+		return japanese.ShiftJIS, true
+	case eucErrors == 0:
+		return japanese.EUCJP, true
+	}
+	return nil, false
+}
+
+// scanShiftJIS returns the number of invalid bytes and kana characters of body as Shift_JIS.
+// a character truncated at the end of body is not counted as invalid.
+func scanShiftJIS(body []byte) (errors int, kana int) {
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c < 0x80, c >= 0xa1 && c <= 0xdf: // ASCII, half-width katakana
+		case c >= 0x81 && c <= 0x9f, c >= 0xe0 && c <= 0xfc:
+			if i+1 >= len(body) {
+				return
+			}
+			t := body[i+1]
+			if t < 0x40 || t == 0x7f || t > 0xfc {
+				errors++
+				continue
+			}
+			if (c == 0x82 && t >= 0x9f && t <= 0xf1) || (c == 0x83 && t >= 0x40 && t <= 0x96) {
+				kana++
+			}
+			i++
+		default:
+			errors++
+		}
+	}
+	return
+}
+
+// scanEUCJP returns the number of invalid bytes and kana characters of body as EUC-JP.
+// a character truncated at the end of body is not counted as invalid.
+func scanEUCJP(body []byte) (errors int, kana int) {
+	isTrail := func(c byte) bool { return c >= 0xa1 && c <= 0xfe }
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c < 0x80:
+		case c == 0x8e: // half-width katakana
+			if i+1 >= len(body) {
+				return
+			}
+			if t := body[i+1]; t < 0xa1 || t > 0xdf {
+				errors++
+				continue
+			}
+			i++
+		case c == 0x8f: // JIS X 0212
+			if i+2 >= len(body) {
+				return
+			}
+			if !isTrail(body[i+1]) || !isTrail(body[i+2]) {
+				errors++
+				continue
+			}
+			i += 2
+		case isTrail(c):
+			if i+1 >= len(body) {
+				return
+			}
+			t := body[i+1]
+			if !isTrail(t) {
+				errors++
+				continue
+			}
+			if (c == 0xa4 && t <= 0xf3) || (c == 0xa5 && t <= 0xf6) {
+				kana++
+			}
+			i++
+		default:
+			errors++
+		}
+	}
+	return
+}
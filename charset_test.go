@@ -0,0 +1,142 @@
+package scraper
+
+import (
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLookupCharset(t *testing.T) {
+	tests := []struct {
+		label string
+		want  encoding.Encoding
+		known bool
+	}{
+		{"windows-1252", charmap.Windows1252, true},
+		{"ISO-8859-1", charmap.Windows1252, true}, // WHATWG maps latin1 to windows-1252
+		{"gb18030", simplifiedchinese.GB18030, true},
+		{"GB2312", simplifiedchinese.GBK, true},
+		{"euc-kr", korean.EUCKR, true},
+		{"big5", traditionalchinese.Big5, true},
+		{"ms_kanji", japanese.ShiftJIS, true},
+		{"cp932", japanese.ShiftJIS, true},
+		{`"Shift_JIS"`, japanese.ShiftJIS, true},
+		{"utf-8", nil, true},
+		{"unicode-1-1-utf-8", nil, true},
+		{"unknown", nil, false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		got, known := lookupCharset(tt.label)
+		if got != tt.want || known != tt.known {
+			t.Errorf("lookupCharset(%q) = %v, %v, want %v, %v", tt.label, got, known, tt.want, tt.known)
+		}
+	}
+}
+
+func TestSniffEncoding(t *testing.T) {
+	mustEncode := func(s string, e encoding.Encoding) []byte {
+		b, err := encode(s, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	const text = "<html><body><p>日本語のテキストです。カタカナ</p></body></html>"
+	padding := "<!--" + strings.Repeat("-", 1100) + "-->"
+	tests := []struct {
+		title       string
+		body        []byte
+		contentType string
+		want        encoding.Encoding
+		wantSource  EncodingSource
+	}{
+		{"UTF-8 BOM", []byte("\xef\xbb\xbf<p>x</p>"), "text/html; charset=Shift_JIS", nil, EncodingSourceBOM},
+		{"UTF-16LE BOM", []byte("\xff\xfe<\x00p\x00>\x00"), "", unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), EncodingSourceBOM},
+		{"meta charset", []byte(`<meta charset="euc-kr"><p>x</p>`), "", korean.EUCKR, EncodingSourceMeta},
+		{"meta http-equiv", []byte(`<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=big5">`), "", traditionalchinese.Big5, EncodingSourceMeta},
+		{"meta after 1024 bytes", []byte("<html><head>" + padding + `<meta charset="gb18030"></head></html>`), "", simplifiedchinese.GB18030, EncodingSourceMeta},
+		{"meta UTF-16 means UTF-8", []byte(`<meta charset="utf-16">`), "", nil, EncodingSourceMeta},
+		{"meta is stronger than Content-Type", []byte(`<meta charset="Shift_JIS">`), "text/html; charset=EUC-JP", japanese.ShiftJIS, EncodingSourceMeta},
+		{"Content-Type", []byte("<p>caf\xe9</p>"), "text/html; charset=windows-1252", charmap.Windows1252, EncodingSourceContentType},
+		{"unknown charset is ignored", []byte("<p>x</p>"), "text/html; charset=x-unknown", nil, EncodingSourceUnknown},
+		{"detect UTF-8", []byte(text), "text/html", nil, EncodingSourceDetected},
+		{"detect Shift_JIS", mustEncode(text, japanese.ShiftJIS), "text/html", japanese.ShiftJIS, EncodingSourceDetected},
+		{"detect EUC-JP", mustEncode(text, japanese.EUCJP), "text/html", japanese.EUCJP, EncodingSourceDetected},
+		{"detect ISO-2022-JP", mustEncode(text, japanese.ISO2022JP), "text/html", japanese.ISO2022JP, EncodingSourceDetected},
+		{"ASCII", []byte("<p>ascii</p>"), "text/html", nil, EncodingSourceUnknown},
+		{"meta in JSON is ignored", []byte(`{"html":"<meta charset=euc-jp><p>日本語</p>"}`), "application/json; charset=utf-8", nil, EncodingSourceContentType},
+		{"JSON without charset is UTF-8", mustEncode(`{"text":"日本語のテキストです"}`, japanese.ShiftJIS), "application/json", nil, EncodingSourceUnknown},
+		{"meta in CSV is ignored", mustEncode("<meta charset=euc-jp>,日本語のテキストです\n", japanese.ShiftJIS), "text/csv", japanese.ShiftJIS, EncodingSourceDetected},
+	}
+	for _, tt := range tests {
+		got, source := sniffEncoding(tt.body, tt.contentType)
+		if got != tt.want || source != tt.wantSource {
+			t.Errorf("%v: sniffEncoding() = %v, %v, want %v, %v", tt.title, got, source, tt.want, tt.wantSource)
+		}
+	}
+}
+
+func TestResponse_DetectEncoding(t *testing.T) {
+	request, err := http.NewRequest("GET", "http://localhost/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := &Response{
+		Request:     request,
+		ContentType: "text/html; charset=windows-1252",
+		RawBody:     []byte("<html><body><p>caf\xe9 \x80</p></body></html>"),
+		Logger:      &DummyLogger{},
+	}
+	page, err := response.Page()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := page.Find("p").Text(); text != "café €" {
+		t.Errorf("text = %q", text)
+	}
+	if page.Encoding != charmap.Windows1252 || page.EncodingSource != EncodingSourceContentType {
+		t.Errorf("page encoding = %v (%v)", page.Encoding, page.EncodingSource)
+	}
+
+	// Encoding set beforehand is kept
+	sjis, err := encode("<p>日本語</p>", japanese.ShiftJIS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = &Response{Request: request, ContentType: "text/html; charset=EUC-JP", RawBody: sjis, Encoding: japanese.ShiftJIS, Logger: &DummyLogger{}}
+	if e, source := response.DetectEncoding(); e != japanese.ShiftJIS || source != EncodingSourceForced {
+		t.Errorf("DetectEncoding() = %v, %v", e, source)
+	}
+
+	// <meta> in a JSON string does not override the header
+	response = &Response{Request: request, ContentType: "application/json; charset=utf-8", RawBody: []byte(`{"html":"<meta charset=euc-jp><p>日本語</p>"}`), Logger: &DummyLogger{}}
+	var v struct{ HTML string }
+	if err := response.JSON(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.HTML != "<meta charset=euc-jp><p>日本語</p>" {
+		t.Errorf("JSON html = %q", v.HTML)
+	}
+
+	// undeclared Shift_JIS CSV
+	csv, err := encode("日付,金額\n2024/01/01,100\n", japanese.ShiftJIS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = &Response{Request: request, ContentType: "text/csv", RawBody: csv, Logger: &DummyLogger{}}
+	records, err := response.CsvReader().ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0][0] != "日付" || response.EncodingSource != EncodingSourceDetected {
+		t.Errorf("records = %v, source = %v", records, response.EncodingSource)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/chromedp/cdproto/browser"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -308,6 +309,7 @@ func (session *ChromeSession) SaveHtml(filename *string) chromedp.Action {
 
 			// Save unified metadata
 			metadata := PageMetadata{
+				Version:     PageMetadataVersion,
 				URL:         currentURL,
 				ContentType: "text/html", // Chrome pages are typically HTML
 				Title:       title,
@@ -343,16 +345,8 @@ func (session *ChromeSession) DownloadFile(filename *string, options DownloadFil
 
 		if options.Glob == "" {
 			options.Glob = "*"
-		} else {
-			// if options.Glob has path separator, it's invalid
-			if dir, _ := path.Split(options.Glob); dir != "" {
-				return fmt.Errorf("invalid glob pattern(contains path component): %v", options.Glob)
-			}
-			// validate options.Glob
-			_, err := filepath.Match(options.Glob, "")
-			if err != nil {
-				return fmt.Errorf("invalid glob pattern(%w): %v", err, options.Glob)
-			}
+		} else if err := validateDownloadGlob(options.Glob); err != nil {
+			return err
 		}
 
 		if session.NotUseNetwork {
@@ -618,9 +612,23 @@ func (session *ChromeSession) actionChrome(action chromedp.Action) (*network.Res
 
 // RunNavigate navigates to page URL and download html like Session.invoke
 func (session *ChromeSession) RunNavigate(URL string) (*network.Response, error) {
+	release, err := session.waitNavigateRateLimit(session.Ctx, URL)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 	return session.actionChrome(chromedp.Navigate(URL))
 }
 
+// waitNavigateRateLimit applies Session.RateLimiter to a navigation to rawURL.
+func (session *ChromeSession) waitNavigateRateLimit(ctx context.Context, rawURL string) (func(), error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return func() {}, nil // let chromedp report the invalid URL
+	}
+	return session.waitRateLimit(ctx, u)
+}
+
 func (session *ChromeSession) Unmarshal(v interface{}, cssSelector string, opt UnmarshalOption) error {
 	return ChromeUnmarshal(session.Ctx, v, cssSelector, opt)
 }
@@ -670,6 +678,12 @@ func (chromeSession *ChromeSession) Navigate(url string) chromedp.ActionFunc {
 			// Record mode: capture current HTML before navigation (for debugging timeouts)
 			chromeSession.captureCurrentHtml(ctx)
 
+			release, err := chromeSession.waitNavigateRateLimit(ctx, url)
+			if err != nil {
+				return err
+			}
+			defer release()
+
 			// Perform actual navigation
 			return chromedp.Run(ctx, chromedp.Navigate(url), chromeSession.SaveHtml(nil))
 		}
@@ -875,9 +889,16 @@ func (chromeSession *ChromeSession) DownloadResource(options UnifiedDownloadOpti
 		Glob:    options.Glob,
 	}
 
-	// Create a basic download action that waits for any download to complete
+	// Create a basic download action that waits for any download to complete,
+	// started by navigating to options.URL or clicking options.Selector if specified
 	// This is a simplified implementation - for complex scenarios, use DownloadFile directly
-	action := chromeSession.DownloadFile(&filename, downloadOptions)
+	var actions []chromedp.Action
+	if options.URL != "" {
+		actions = append(actions, chromedp.Navigate(options.URL))
+	} else if options.Selector != "" {
+		actions = append(actions, chromedp.Click(options.Selector, chromedp.ByQuery))
+	}
+	action := chromeSession.DownloadFile(&filename, downloadOptions, actions...)
 	err := chromedp.Run(chromeSession.Ctx, action)
 
 	if err != nil {
@@ -0,0 +1,87 @@
+package scraper
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// acceptEncoding is the built-in Accept-Encoding header of Session.
+// responses are decoded by Session instead of http.Transport, which handles only gzip.
+const acceptEncoding = "gzip, deflate, br"
+
+// contentEncoding returns the Content-Encoding of header, or "" if the body is not encoded.
+func contentEncoding(header http.Header) string {
+	var codings []string
+	for _, value := range header.Values("Content-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			if coding = strings.ToLower(strings.TrimSpace(coding)); coding != "" && coding != "identity" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+	return strings.Join(codings, ", ")
+}
+
+// newContentDecoder returns a reader decoding r encoded with contentEncoding (e.g. "gzip" or "gzip, br").
+// the codings are decoded in the reverse order they were applied.
+// an empty body (e.g. of 204 or HEAD responses) is returned as is.
+func newContentDecoder(contentEncoding string, r io.Reader) (io.Reader, error) {
+	if contentEncoding == "" {
+		return r, nil
+	}
+	buffered := bufio.NewReader(r)
+	if _, err := buffered.Peek(1); err == io.EOF {
+		return buffered, nil
+	}
+	r = buffered
+	codings := strings.Split(contentEncoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		switch coding := strings.ToLower(strings.TrimSpace(codings[i])); coding {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid gzip content: %w", err)
+			}
+			r = gz
+		case "deflate":
+			var err error
+			if r, err = newDeflateReader(r); err != nil {
+				return nil, fmt.Errorf("invalid deflate content: %w", err)
+			}
+		case "br":
+			r = brotli.NewReader(r)
+		default:
+			return nil, fmt.Errorf("unsupported Content-Encoding: %v", coding)
+		}
+	}
+	return r, nil
+}
+
+// newDeflateReader returns a reader of deflate content, which is zlib format by the spec
+// but raw deflate data from some servers.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// decodeContent returns body decoded from contentEncoding.
+func decodeContent(contentEncoding string, body []byte) ([]byte, error) {
+	r, err := newContentDecoder(contentEncoding, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
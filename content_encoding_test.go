@@ -0,0 +1,237 @@
+package scraper
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"github.com/andybalholm/brotli"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func compress(t *testing.T, coding string, body []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		t.Fatalf("unknown coding %v", coding)
+	}
+	if _, err := w.Write(body); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSession_ContentEncoding(t *testing.T) {
+	html := []byte("<html><body>" + strings.Repeat("compressed ", 100) + "</body></html>")
+	bodies := map[string][]byte{
+		"/gzip":        compress(t, "gzip", html),
+		"/deflate":     compress(t, "deflate", html),
+		"/raw-deflate": compress(t, "raw-deflate", html),
+		"/br":          compress(t, "br", html),
+		"/gzip-br":     compress(t, "br", compress(t, "gzip", html)),
+		"/identity":    html,
+	}
+	codings := map[string]string{
+		"/gzip":        "gzip",
+		"/deflate":     "deflate",
+		"/raw-deflate": "deflate",
+		"/br":          "br",
+		"/gzip-br":     "gzip, br",
+		"/identity":    "identity",
+	}
+	var acceptEncodings []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncodings = append(acceptEncodings, r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", codings[r.URL.Path])
+		_, _ = w.Write(bodies[r.URL.Path])
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	session := NewSession("content_encoding", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.SaveToFile = true
+	session.SaveCompressedBody = true
+
+	paths := []string{"/gzip", "/deflate", "/raw-deflate", "/br", "/gzip-br", "/identity"}
+	for _, p := range paths {
+		resp, err := session.Get(ts.URL + p)
+		if err != nil {
+			t.Fatalf("%v: %v", p, err)
+		}
+		if !bytes.Equal(resp.RawBody, html) {
+			t.Errorf("%v: RawBody = %q", p, resp.RawBody)
+		}
+		want := codings[p]
+		if want == "identity" {
+			want = ""
+		}
+		if resp.ContentEncoding != want {
+			t.Errorf("%v: ContentEncoding = %q, want %q", p, resp.ContentEncoding, want)
+		}
+		if want != "" && !bytes.Equal(resp.CompressedBody, bodies[p]) {
+			t.Errorf("%v: CompressedBody is not the received bytes", p)
+		}
+	}
+	if acceptEncodings[0] != "gzip, deflate, br" {
+		t.Errorf("Accept-Encoding = %v", acceptEncodings[0])
+	}
+
+	// the compressed body is recorded and decoded in replay
+	saved, err := os.ReadFile(path.Join(dir, "content_encoding", "4.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saved, bodies["/br"]) {
+		t.Errorf("saved body is not the received bytes")
+	}
+	metadata, err := loadPageMetadata(path.Join(dir, "content_encoding", "4.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.ContentEncoding != "br" || !metadata.CompressedBody {
+		t.Errorf("metadata = %+v", metadata)
+	}
+
+	replay := NewSession("content_encoding", &BufferedLogger{})
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	for _, p := range paths {
+		resp, err := replay.Get(ts.URL + p)
+		if err != nil {
+			t.Fatalf("replay %v: %v", p, err)
+		}
+		if !bytes.Equal(resp.RawBody, html) {
+			t.Errorf("replay %v: RawBody = %q", p, resp.RawBody)
+		}
+	}
+}
+
+func TestSession_ContentEncodingRedactor(t *testing.T) {
+	html := []byte("<html><body>account=9876543</body></html>")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(compress(t, "gzip", html))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	session := NewSession("content_encoding_redactor", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.SaveToFile = true
+	session.SaveCompressedBody = true
+	session.Redactor = &Redactor{Patterns: []*regexp.Regexp{regexp.MustCompile(`account=(\d+)`)}}
+	if _, err := session.Get(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := path.Join(dir, "content_encoding_redactor", "1.html")
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<html><body>account=" + RedactedValue + "</body></html>"; string(saved) != want {
+		t.Errorf("saved %q, want %q", saved, want)
+	}
+	metadata, err := loadPageMetadata(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.CompressedBody {
+		t.Error("metadata.CompressedBody is set for the masked body")
+	}
+
+	replay := NewSession("content_encoding_redactor", &BufferedLogger{})
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	resp, err := replay.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(resp.RawBody), RedactedValue) {
+		t.Errorf("replayed %q", resp.RawBody)
+	}
+}
+
+func TestSession_DownloadContentEncoding(t *testing.T) {
+	content := []byte(strings.Repeat("date,amount\n", 1000))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(compress(t, "gzip", content))
+	}))
+	defer ts.Close()
+
+	session := NewSession("download_encoding", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	var total int64
+	filename, err := session.Download(context.Background(), ts.URL+"/data.csv", DownloadOptions{
+		Progress: func(written, size int64) { total = size },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filename); !bytes.Equal(got, content) {
+		t.Errorf("saved %v bytes, want decoded %v bytes", len(got), len(content))
+	}
+	if total != -1 {
+		t.Errorf("total = %v, want -1 for encoded content", total)
+	}
+}
+
+func TestNewContentDecoder_Unsupported(t *testing.T) {
+	if _, err := newContentDecoder("compress", strings.NewReader("\x1f\x9d")); err == nil {
+		t.Error("unsupported coding is accepted")
+	}
+}
+
+func TestSession_EmptyEncodedBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	session := NewSession("empty_encoded", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.SaveToFile = true
+	resp, err := session.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.RawBody) != 0 {
+		t.Errorf("RawBody = %q", resp.RawBody)
+	}
+	if _, err := session.Download(context.Background(), ts.URL+"/empty.csv", DownloadOptions{}); err != nil {
+		t.Errorf("Download: %v", err)
+	}
+
+	replay := NewSession("empty_encoded", &BufferedLogger{})
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	if _, err := replay.Get(ts.URL); err != nil {
+		t.Errorf("replay: %v", err)
+	}
+}
@@ -0,0 +1,511 @@
+package scraper
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DownloadOptions holds options of Session.Download.
+type DownloadOptions struct {
+	RequestOption
+
+	// Filename is the name of the saved file in the session directory, overwriting a file of the same name.
+	// "" names it from the sequence number and the filename of Content-Disposition or the URL path
+	// (e.g. "3-report.csv"). names of the session files (cookie and recordings) are rejected.
+	Filename string
+	// Resume continues the .part file left by an interrupted download with a Range request.
+	// the whole file is downloaded again if the server ignores the range.
+	Resume   bool
+	MaxBytes int64 // fail with DownloadTooLargeError if the file exceeds this size (0 = no limit)
+	// Checksum is the expected digest of the file as "algorithm:hex" (sha256, sha512, sha1 or md5).
+	// a mismatch fails with ChecksumMismatchError and removes the file.
+	Checksum string
+	// Progress is called after each chunk is written with the bytes written so far,
+	// including the resumed part, and the total size (-1 if unknown).
+	Progress func(written, total int64)
+}
+
+// Download streams the body of GET rawURL to a file in the session directory
+// without holding it in memory, and returns the path of the file.
+// it is recorded like Get if SaveToFile is set, and returns the recorded file in NotUseNetwork mode.
+func (session *Session) Download(ctx context.Context, rawURL string, opt DownloadOptions) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := session.download(req, opt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Filename, nil
+}
+
+// download invokes req through Session.Hooks, saving the body to the file of Response.Filename.
+func (session *Session) download(req *http.Request, opt DownloadOptions) (*Response, error) {
+	if opt.Filename != "" && (path.Base(opt.Filename) != opt.Filename || strings.ContainsRune(opt.Filename, '\\')) {
+		return nil, fmt.Errorf("invalid download filename(contains path component): %v", opt.Filename)
+	}
+	if sessionFileRegexp.MatchString(opt.Filename) {
+		return nil, fmt.Errorf("invalid download filename(used by the session): %v", opt.Filename)
+	}
+	if _, err := newChecksumHash(opt.Checksum); err != nil {
+		return nil, err
+	}
+	if !session.NotUseNetwork {
+		if opt.Header.Get("Accept") == "" {
+			opt.Header = opt.Header.Clone()
+			if opt.Header == nil {
+				opt.Header = http.Header{}
+			}
+			opt.Header.Set("Accept", "*/*")
+		}
+		session.setRequestHeader(req, opt.RequestOption)
+	}
+	return session.invokeHooks(req, func(req *http.Request) (*Response, error) {
+		return session.downloadRequest(req, opt)
+	})
+}
+
+func (session *Session) downloadRequest(req *http.Request, opt DownloadOptions) (*Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, RequestError{req.URL, err}
+	}
+	if err := session.makeDirectory(); err != nil {
+		return nil, err
+	}
+
+	var recorded *RecordedRequest
+	if session.SaveToFile || (session.NotUseNetwork && session.ReplayMode == ReplayByRequest) {
+		var err error
+		if recorded, err = newRecordedRequest(req, session.Redactor); err != nil {
+			return nil, RequestError{req.URL, err}
+		}
+	}
+
+	session.invokeCount++
+	if session.NotUseNetwork {
+		return session.loadDownload(req, recorded, opt)
+	}
+
+	// the name of the .part file is decided before the request for resuming,
+	// the file is renamed to the name from the response after the download
+	filename := opt.Filename
+	if filename == "" {
+		filename = fmt.Sprintf("%v-%v", session.invokeCount, downloadFilename(req.URL))
+	}
+	partFilename := path.Join(session.getDirectory(), filename) + ".part"
+
+	var offset int64
+	if opt.Resume {
+		if info, err := os.Stat(partFilename); err == nil && info.Size() > 0 {
+			offset = info.Size()
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			// the range must be of the decoded bytes in the .part file
+			req.Header.Set("Accept-Encoding", "identity")
+		}
+	}
+
+	if session.ShowRequestHeader {
+		session.Printf("REQUEST: %v %v:\n", req.Method, session.Redactor.url(req.URL.String()))
+		session.Printf("Request header:{\n")
+		session.printHeader(session.Redactor.header(req.Header))
+		session.Printf("}\n")
+	}
+
+	response, release, err := session.do(req.WithContext(withRedirectPolicy(req.Context(), session.redirectPolicy(opt.RequestOption))))
+	if err != nil {
+		return nil, RequestError{req.URL, err}
+	}
+	defer release()
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	req = response.Request // update req.Url after redirects
+	redirects := redirectChain(response)
+	if session.ShowResponseHeader {
+		session.Printf("Response Status: %v\n", response.Status)
+		session.Printf("Response Header:\n")
+		session.printHeader(session.Redactor.header(response.Header))
+		session.printRedirects(redirects)
+	}
+	if !session.acceptStatus(response.StatusCode, opt.RequestOption) {
+		return nil, ResponseError{req.URL, response}
+	}
+
+	contentType := response.Header.Get("content-type")
+	if opt.Filename == "" {
+		fallback := session.Encoding
+		if fallback == nil {
+			if fallback = getEncodingFromCharset(charsetFromContentType(contentType)); fallback == nil {
+				fallback = japanese.ShiftJIS
+			}
+		}
+		// the sequence number keeps recordings of the same name apart, and away from the session files
+		name := contentDispositionFilename(response.Header.Get("Content-Disposition"), fallback)
+		if name == "" {
+			name = downloadFilename(req.URL)
+		}
+		filename = fmt.Sprintf("%v-%v", session.invokeCount, name)
+	}
+	filename = path.Join(session.getDirectory(), filename)
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 && response.StatusCode == http.StatusPartialContent {
+		if start, ok := contentRangeStart(response.Header.Get("Content-Range")); !ok || start != offset {
+			return nil, fmt.Errorf("%v: unexpected Content-Range %q for resuming from %v bytes", req.URL, response.Header.Get("Content-Range"), offset)
+		}
+		flag = os.O_WRONLY | os.O_APPEND
+		session.Printf("%s DOWNLOAD resuming %v from %v bytes\n", session.getDebugPrefix(), partFilename, offset)
+	} else {
+		offset = 0
+	}
+
+	coding := contentEncoding(response.Header)
+	body, err := newContentDecoder(coding, response.Body)
+	if err != nil {
+		return nil, RequestError{req.URL, err}
+	}
+	total := int64(-1)
+	if response.ContentLength >= 0 && coding == "" {
+		total = offset + response.ContentLength
+	}
+	if opt.MaxBytes > 0 && total > opt.MaxBytes {
+		return nil, DownloadTooLargeError{URL: req.URL.String(), MaxBytes: opt.MaxBytes}
+	}
+
+	file, err := os.OpenFile(partFilename, flag, os.FileMode(0644))
+	if err != nil {
+		return nil, err
+	}
+	writer := &downloadWriter{
+		w:        file,
+		url:      req.URL.String(),
+		written:  offset,
+		total:    total,
+		maxBytes: opt.MaxBytes,
+		progress: opt.Progress,
+	}
+	_, err = io.Copy(writer, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if _, ok := err.(DownloadTooLargeError); ok {
+			_ = os.Remove(partFilename)
+		}
+		return nil, err
+	}
+
+	if err := verifyChecksum(partFilename, opt.Checksum); err != nil {
+		_ = os.Remove(partFilename)
+		return nil, err
+	}
+	if err := os.Rename(partFilename, filename); err != nil {
+		return nil, err
+	}
+	session.Printf("%s DOWNLOAD saved to %v (%v bytes)\n", session.getDebugPrefix(), filename, writer.written)
+
+	if session.SaveToFile {
+		metadata := PageMetadata{
+			Version:         PageMetadataVersion,
+			URL:             req.URL.String(),
+			ContentType:     contentType,
+			StatusCode:      response.StatusCode,
+			Header:          response.Header,
+			Method:          req.Method,
+			RequestHeader:   req.Header,
+			Redirects:       redirects,
+			Request:         recorded,
+			File:            path.Base(filename),
+			ContentEncoding: coding,
+		}
+		if err := savePageMetadata(session.getHtmlFilename(), session.Redactor.metadata(metadata)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Response{
+		Request:         req,
+		StatusCode:      response.StatusCode,
+		Header:          response.Header,
+		Redirects:       redirects,
+		ContentType:     contentType,
+		ContentEncoding: coding,
+		Filename:        filename,
+		Encoding:        session.Encoding,
+		Logger:          session,
+	}, nil
+}
+
+// loadDownload returns the file recorded for req in NotUseNetwork mode.
+func (session *Session) loadDownload(req *http.Request, recorded *RecordedRequest, opt DownloadOptions) (*Response, error) {
+	filename := session.getHtmlFilename()
+	if session.ReplayMode == ReplayByRequest {
+		var err error
+		if filename, err = session.replayFilename(recorded); err != nil {
+			session.Printf("%s %v\n", session.getDebugPrefix(), err)
+			return nil, err
+		}
+	}
+	metadata, err := loadPageMetadata(filename)
+	if err != nil || metadata.File == "" {
+		return nil, RetryAndRecordError{filename}
+	}
+	saved := path.Join(session.getDirectory(), metadata.File)
+	if _, err := os.Stat(saved); err != nil {
+		return nil, RetryAndRecordError{saved}
+	}
+	session.Printf("%s REPLAY DOWNLOADED: %v\n", session.getDebugPrefix(), saved)
+	if err := verifyChecksum(saved, opt.Checksum); err != nil {
+		return nil, err
+	}
+
+	if savedURL, parseErr := url.Parse(metadata.URL); parseErr == nil {
+		req.URL = savedURL
+	}
+	if metadata.RequestHeader != nil {
+		req.Header = metadata.RequestHeader
+	}
+	statusCode := metadata.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	header := metadata.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &Response{
+		Request:         req,
+		StatusCode:      statusCode,
+		Header:          header,
+		Redirects:       metadata.Redirects,
+		ContentType:     metadata.ContentType,
+		ContentEncoding: metadata.ContentEncoding,
+		Filename:        saved,
+		Encoding:        session.Encoding,
+		Logger:          session,
+	}, nil
+}
+
+// sessionFileRegexp matches names of files of the session directory other than downloads:
+// the cookie jar and recordings of requests (e.g. "3.html" and "3.html.meta").
+var sessionFileRegexp = regexp.MustCompile(`^(cookie|\d+\.html(\..*)?)$`)
+
+// downloadFilename returns the last element of the path of u usable as a filename.
+func downloadFilename(u *url.URL) string {
+	name := sanitizeFilename(path.Base(u.Path))
+	if name == "" {
+		return "download"
+	}
+	return name
+}
+
+// sanitizeFilename replaces characters unsafe in filenames with '_'.
+// returns "" for an empty name or a name of dots only.
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if strings.Trim(name, ".") == "" {
+		return ""
+	}
+	return name
+}
+
+// contentDispositionFilename returns the filename of a Content-Disposition header value
+// without directory components, preferring the RFC 5987 filename* parameter.
+// a filename parameter of bytes not in UTF-8, raw or percent-encoded (e.g. Shift_JIS names
+// sent by some Japanese sites), is decoded with fallback. returns "" if there is no usable filename.
+func contentDispositionFilename(value string, fallback encoding.Encoding) string {
+	params := headerParams(value)
+	var name string
+	if extended, ok := params["filename*"]; ok {
+		// charset'language'percent-encoded
+		if charset, rest, ok := strings.Cut(extended, "'"); ok {
+			if _, encoded, ok := strings.Cut(rest, "'"); ok {
+				if b, err := url.PathUnescape(encoded); err == nil {
+					e := fallback
+					if strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "us-ascii") {
+						e = nil
+					} else if c := getEncodingFromCharset(charset); c != nil {
+						e = c
+					}
+					name = decodeFilename([]byte(b), e)
+				}
+			}
+		}
+	}
+	if name == "" {
+		b := params["filename"]
+		if strings.Contains(b, "%") {
+			if unescaped, err := url.PathUnescape(b); err == nil {
+				b = unescaped
+			}
+		}
+		name = decodeFilename([]byte(b), fallback)
+	}
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return sanitizeFilename(name)
+}
+
+// decodeFilename returns b as UTF-8, decoding it with e unless it is valid UTF-8.
+func decodeFilename(b []byte, e encoding.Encoding) string {
+	if !utf8.Valid(b) && e != nil {
+		if decoded, _, err := transform.Bytes(e.NewDecoder(), b); err == nil {
+			b = decoded
+		}
+	}
+	return strings.ToValidUTF8(string(b), "_")
+}
+
+// headerParams returns the parameters of a header value like `attachment; filename="a.csv"` by lower-cased names.
+// quoted values are unquoted.
+func headerParams(value string) map[string]string {
+	params := map[string]string{}
+	var part []byte
+	flush := func() {
+		if key, val, ok := strings.Cut(string(part), "="); ok {
+			params[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(val)
+		}
+		part = part[:0]
+	}
+	quoted, escaped := false, false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case escaped:
+			part = append(part, c)
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == ';':
+			flush()
+		default:
+			part = append(part, c)
+		}
+	}
+	flush()
+	return params
+}
+
+// validateDownloadGlob validates glob, a pattern of downloaded filenames.
+func validateDownloadGlob(glob string) error {
+	// if glob has path separator, it's invalid
+	if dir, _ := path.Split(glob); dir != "" {
+		return fmt.Errorf("invalid glob pattern(contains path component): %v", glob)
+	}
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return fmt.Errorf("invalid glob pattern(%w): %v", err, glob)
+	}
+	return nil
+}
+
+// contentRangeStart returns the first byte position of a Content-Range header (e.g. "bytes 100-199/200").
+func contentRangeStart(contentRange string) (int64, bool) {
+	spec, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	start, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(start), 10, 64)
+	return n, err == nil
+}
+
+// downloadWriter counts bytes written to w, enforcing maxBytes and reporting progress.
+type downloadWriter struct {
+	w        io.Writer
+	url      string
+	written  int64
+	total    int64
+	maxBytes int64
+	progress func(written, total int64)
+}
+
+func (d *downloadWriter) Write(p []byte) (int, error) {
+	if d.maxBytes > 0 && d.written+int64(len(p)) > d.maxBytes {
+		return 0, DownloadTooLargeError{URL: d.url, MaxBytes: d.maxBytes}
+	}
+	n, err := d.w.Write(p)
+	d.written += int64(n)
+	if d.progress != nil && n > 0 {
+		d.progress(d.written, d.total)
+	}
+	return n, err
+}
+
+// newChecksumHash returns the hash of the algorithm of checksum ("algorithm:hex"), or nil for "".
+func newChecksumHash(checksum string) (hash.Hash, error) {
+	if checksum == "" {
+		return nil, nil
+	}
+	algorithm, _, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid checksum %q: must be algorithm:hex", checksum)
+	}
+	switch strings.ToLower(algorithm) {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("invalid checksum %q: unsupported algorithm %v", checksum, algorithm)
+}
+
+// verifyChecksum verifies the digest of filename with checksum ("algorithm:hex"). "" skips the verification.
+func verifyChecksum(filename string, checksum string) error {
+	h, err := newChecksumHash(checksum)
+	if err != nil || h == nil {
+		return err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+	algorithm, expected, _ := strings.Cut(checksum, ":")
+	actual := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(actual, expected) {
+		return ChecksumMismatchError{Filename: filename, Expected: checksum, Actual: strings.ToLower(algorithm) + ":" + actual}
+	}
+	return nil
+}
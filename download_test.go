@@ -0,0 +1,393 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/text/encoding/japanese"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newDownloadServer(t *testing.T, content []byte) (*httptest.Server, *[]string) {
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("Content-Type", "text/csv")
+		http.ServeContent(w, r, path.Base(r.URL.Path), time.Time{}, bytes.NewReader(content))
+	}))
+	return ts, &ranges
+}
+
+func TestSession_Download(t *testing.T) {
+	content := []byte(strings.Repeat("date,amount\n2024-01-01,100\n", 2000))
+	sum := sha256.Sum256(content)
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+	ts, _ := newDownloadServer(t, content)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	session := NewSession("download", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.SaveToFile = true
+
+	var progress []int64
+	var total int64
+	filename, err := session.Download(context.Background(), ts.URL+"/statements/report.csv", DownloadOptions{
+		Checksum: checksum,
+		Progress: func(written, size int64) {
+			progress = append(progress, written)
+			total = size
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := path.Join(dir, "download", "1-report.csv"); filename != want {
+		t.Errorf("filename = %v, want %v", filename, want)
+	}
+	if got, _ := os.ReadFile(filename); !bytes.Equal(got, content) {
+		t.Errorf("saved %v bytes, want %v", len(got), len(content))
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != int64(len(content)) || total != int64(len(content)) {
+		t.Errorf("progress = %v, total = %v", progress, total)
+	}
+	if _, err := os.Stat(filename + ".part"); !os.IsNotExist(err) {
+		t.Errorf(".part file is left: %v", err)
+	}
+
+	replay := NewSession("download", &BufferedLogger{})
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	replay.ReplayMode = ReplayByRequest
+	got, err := replay.Download(context.Background(), ts.URL+"/statements/report.csv", DownloadOptions{Checksum: checksum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != filename {
+		t.Errorf("replayed filename = %v, want %v", got, filename)
+	}
+	_, err = replay.Download(context.Background(), ts.URL+"/other.csv", DownloadOptions{})
+	var mismatch ReplayMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Errorf("err = %v, want ReplayMismatchError", err)
+	}
+}
+
+func TestSession_DownloadResume(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	ts, ranges := newDownloadServer(t, content)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	session := NewSession("resume", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	if err := os.Mkdir(path.Join(dir, "resume"), 0744); err != nil {
+		t.Fatal(err)
+	}
+	partFilename := path.Join(dir, "resume", "data.bin.part")
+	if err := os.WriteFile(partFilename, content[:4000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var first int64
+	filename, err := session.Download(context.Background(), ts.URL+"/data.bin", DownloadOptions{
+		Filename: "data.bin",
+		Resume:   true,
+		Progress: func(written, total int64) {
+			if first == 0 {
+				first = written
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bytes=4000-"}; strings.Join(*ranges, ",") != strings.Join(want, ",") {
+		t.Errorf("ranges = %v, want %v", *ranges, want)
+	}
+	if got, _ := os.ReadFile(filename); !bytes.Equal(got, content) {
+		t.Errorf("resumed file has %v bytes, want %v", len(got), len(content))
+	}
+	if first <= 4000 {
+		t.Errorf("first progress = %v, want > 4000", first)
+	}
+}
+
+func TestSession_DownloadErrors(t *testing.T) {
+	content := []byte(strings.Repeat("x", 10000))
+	ts, _ := newDownloadServer(t, content)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	session := NewSession("download_errors", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	ctx := context.Background()
+
+	_, err := session.Download(ctx, ts.URL+"/big", DownloadOptions{Filename: "big", MaxBytes: 1000})
+	var tooLarge DownloadTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.MaxBytes != 1000 {
+		t.Errorf("err = %v, want DownloadTooLargeError", err)
+	}
+
+	_, err = session.Download(ctx, ts.URL+"/bad", DownloadOptions{Filename: "bad", Checksum: "md5:00000000000000000000000000000000"})
+	var mismatch ChecksumMismatchError
+	if !errors.As(err, &mismatch) || !strings.HasPrefix(mismatch.Actual, "md5:") {
+		t.Errorf("err = %v, want ChecksumMismatchError", err)
+	}
+	for _, name := range []string{"big", "big.part", "bad", "bad.part"} {
+		if _, err := os.Stat(path.Join(dir, "download_errors", name)); !os.IsNotExist(err) {
+			t.Errorf("%v is left: %v", name, err)
+		}
+	}
+
+	if _, err := session.Download(ctx, ts.URL, DownloadOptions{Filename: "../escape"}); err == nil {
+		t.Error("filename with a path component is accepted")
+	}
+	if _, err := session.Download(ctx, ts.URL, DownloadOptions{Checksum: "crc32:0"}); err == nil {
+		t.Error("unsupported checksum algorithm is accepted")
+	}
+	for _, name := range []string{"cookie", "3.html", "3.html.meta"} {
+		if _, err := session.Download(ctx, ts.URL, DownloadOptions{Filename: name}); err == nil {
+			t.Errorf("filename %v of the session is accepted", name)
+		}
+	}
+}
+
+func TestSession_DownloadResourceGlob(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = w.Write([]byte(`<html><body><a href="/export">CSV</a></body></html>`))
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="report-2024.csv"`)
+		_, _ = w.Write([]byte("a,b\n"))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	session := NewSession("download_glob", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	if err := session.Navigate(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	filename, err := session.DownloadResource(UnifiedDownloadOptions{Selector: "a", Glob: "report-*.csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Base(filename) != "2-report-2024.csv" {
+		t.Errorf("filename = %v", filename)
+	}
+
+	_, err = session.DownloadResource(UnifiedDownloadOptions{Selector: "a", Glob: "summary-*.csv"})
+	var notSatisfied *DownloadedFileNameNotSatisfiedError
+	if !errors.As(err, &notSatisfied) {
+		t.Fatalf("err = %v, want DownloadedFileNameNotSatisfiedError", err)
+	}
+	if _, err := os.Stat(notSatisfied.DownloadedFilename); !os.IsNotExist(err) {
+		t.Errorf("mismatched file %v is left: %v", notSatisfied.DownloadedFilename, err)
+	}
+}
+
+func TestSession_DownloadSameFilename(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="meisai.csv"`)
+		_, _ = fmt.Fprintf(w, "month=%v\n", r.URL.Query().Get("month"))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	session := NewSession("download_same", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.SaveToFile = true
+	var filenames []string
+	for _, month := range []string{"1", "2"} {
+		filename, err := session.Download(context.Background(), ts.URL+"/export?month="+month, DownloadOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, filename)
+	}
+	if filenames[0] == filenames[1] {
+		t.Fatalf("both downloads are saved to %v", filenames[0])
+	}
+
+	replay := NewSession("download_same", &BufferedLogger{})
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	for i, month := range []string{"1", "2"} {
+		filename, err := replay.Download(context.Background(), ts.URL+"/export?month="+month, DownloadOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filename != filenames[i] {
+			t.Errorf("replayed filename = %v, want %v", filename, filenames[i])
+		}
+		if got, _ := os.ReadFile(filename); string(got) != "month="+month+"\n" {
+			t.Errorf("replayed month %v: %q", month, got)
+		}
+	}
+}
+
+func TestSession_DownloadSessionFilename(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/page" {
+			_, _ = w.Write([]byte("<html><body>page</body></html>"))
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+path.Base(r.URL.Path)+`"`)
+		_, _ = w.Write([]byte("overwritten"))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	session := NewSession("download_session_file", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.SaveToFile = true
+	if _, err := session.Get(ts.URL + "/page"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"cookie", "1.html", "1.html.meta"} {
+		filename, err := session.Download(context.Background(), ts.URL+"/"+name, DownloadOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path.Base(filename) == name {
+			t.Errorf("download is saved to %v", filename)
+		}
+	}
+	if got, _ := os.ReadFile(path.Join(dir, "download_session_file", "1.html")); string(got) != "<html><body>page</body></html>" {
+		t.Error("the recording is overwritten")
+	}
+}
+
+func TestSession_DownloadResource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=Shift_JIS")
+		_, _ = w.Write([]byte("<html><body>\x93\xfa\x96\x7b</body></html>"))
+	}))
+	defer ts.Close()
+
+	session := NewSession("download_resource", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	if err := session.Navigate(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	filename, err := session.DownloadResource(UnifiedDownloadOptions{SaveAs: "page.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Base(filename) != "page.html" {
+		t.Errorf("filename = %v", filename)
+	}
+	if got, _ := os.ReadFile(filename); string(got) != "<html><body>\x93\xfa\x96\x7b</body></html>" {
+		t.Errorf("saved %q, want raw bytes", got)
+	}
+}
+
+func TestContentDispositionFilename(t *testing.T) {
+	sjis, err := encode("明細.csv", japanese.ShiftJIS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`attachment; filename="report.pdf"`, "report.pdf"},
+		{`attachment; filename=report.pdf`, "report.pdf"},
+		{`attachment; filename*=UTF-8''%E6%98%8E%E7%B4%B0.csv`, "明細.csv"},
+		{`attachment; filename="fallback.csv"; filename*=utf-8''%E6%98%8E%E7%B4%B0.csv`, "明細.csv"},
+		{`attachment; filename*=Shift_JIS''%96%BE%8D%D7.csv`, "明細.csv"},
+		{`attachment; filename="` + string(sjis) + `"`, "明細.csv"},
+		{`attachment; filename="%96%BE%8D%D7.csv"`, "明細.csv"},
+		{`attachment; filename="%E6%98%8E%E7%B4%B0.csv"`, "明細.csv"},
+		{`attachment; filename="a \"quoted\"; name.txt"`, "a _quoted_; name.txt"},
+		{`attachment; filename="../../etc/passwd"`, "passwd"},
+		{`attachment; filename="C:\\temp\\x.txt"`, "x.txt"},
+		{`attachment; filename=".."`, ""},
+		{`inline`, ""},
+		{``, ""},
+	}
+	for _, tt := range tests {
+		if got := contentDispositionFilename(tt.value, japanese.ShiftJIS); got != tt.want {
+			t.Errorf("contentDispositionFilename(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSession_DownloadResourceSelector(t *testing.T) {
+	sjis, err := encode("明細.csv", japanese.ShiftJIS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<html><body><a class="csv" href="/export?id=1">CSV</a><img src="/logo.png"></body></html>`))
+		case "/export":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+string(sjis)+`"`)
+			_, _ = w.Write([]byte("a,b\n1,2\n"))
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("\x89PNG"))
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	session := NewSession("download_selector", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.SaveToFile = true
+	if err := session.Navigate(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	filename, err := session.DownloadResource(UnifiedDownloadOptions{Selector: "a.csv", Glob: "*.csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := path.Join(dir, "download_selector", "2-明細.csv"); filename != want {
+		t.Errorf("filename = %v, want %v", filename, want)
+	}
+	if got, _ := os.ReadFile(filename); string(got) != "a,b\n1,2\n" {
+		t.Errorf("saved %q", got)
+	}
+	_, err = session.DownloadResource(UnifiedDownloadOptions{Selector: "img", Glob: "*.csv"})
+	var notSatisfied *DownloadedFileNameNotSatisfiedError
+	if !errors.As(err, &notSatisfied) {
+		t.Errorf("err = %v, want DownloadedFileNameNotSatisfiedError", err)
+	}
+	if _, err := session.DownloadResource(UnifiedDownloadOptions{Selector: "a.missing"}); err == nil {
+		t.Error("missing selector is accepted")
+	}
+
+	replay := NewSession("download_selector", &BufferedLogger{})
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	replay.ReplayMode = ReplayByRequest
+	if err := replay.Navigate(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	got, err := replay.DownloadResource(UnifiedDownloadOptions{Selector: "a.csv", Glob: "*.csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != filename {
+		t.Errorf("replayed filename = %v, want %v", got, filename)
+	}
+	_, err = replay.DownloadResource(UnifiedDownloadOptions{URL: "/other.csv"})
+	var mismatch ReplayMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Errorf("err = %v, want ReplayMismatchError", err)
+	}
+}
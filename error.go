@@ -2,6 +2,8 @@ package scraper
 
 import (
 	"fmt"
+	"golang.org/x/text/encoding"
+	"strings"
 	"time"
 )
 
@@ -13,6 +15,79 @@ func (error RetryAndRecordError) Error() string {
 	return fmt.Sprintf("Record file '%v' is missing while replaying! Retry with 'record' mode!", error.Filename)
 }
 
+// ReplayMismatchError reports a request which is not found in the recording in ReplayByRequest mode.
+type ReplayMismatchError struct {
+	Sequence int              // 1-origin sequence number of the request in this session
+	Request  RecordedRequest  // the request which diverged from the recording
+	Recorded *RecordedRequest // the request recorded at the same sequence number (nil if none)
+}
+
+func (error ReplayMismatchError) Error() string {
+	if error.Recorded == nil {
+		return fmt.Sprintf("Replay mismatch at request #%v: %v is not in the recording", error.Sequence, error.Request)
+	}
+	return fmt.Sprintf("Replay mismatch at request #%v: %v is not in the recording (recorded #%v: %v). Retry with 'record' mode!", error.Sequence, error.Request, error.Sequence, *error.Recorded)
+}
+
+// FormValidationError reports a form not submitted because Form.Validate found violations.
+type FormValidationError struct {
+	Violations []FormViolation
+}
+
+func (error FormValidationError) Error() string {
+	messages := make([]string, len(error.Violations))
+	for i, v := range error.Violations {
+		messages[i] = v.String()
+	}
+	return fmt.Sprintf("Form validation failed: %v", strings.Join(messages, ", "))
+}
+
+// FormEncodingError reports a form value which can not be encoded in the charset of the form.
+type FormEncodingError struct {
+	Name     string // name of the element
+	Value    string // the value containing unencodable characters
+	Encoding encoding.Encoding
+	Err      error
+}
+
+func (error FormEncodingError) Error() string {
+	return fmt.Sprintf("Form element %v: %q can not be encoded in %v: %v", error.Name, error.Value, error.Encoding, error.Err)
+}
+
+func (error FormEncodingError) Unwrap() error {
+	return error.Err
+}
+
+// TooManyRedirectsError reports a request which exceeded the maximum number of redirects.
+type TooManyRedirectsError struct {
+	Max int
+}
+
+func (error TooManyRedirectsError) Error() string {
+	return fmt.Sprintf("stopped after %v redirects", error.Max)
+}
+
+// DownloadTooLargeError reports a download exceeding DownloadOptions.MaxBytes.
+type DownloadTooLargeError struct {
+	URL      string
+	MaxBytes int64
+}
+
+func (error DownloadTooLargeError) Error() string {
+	return fmt.Sprintf("Download of %v exceeds the limit of %v bytes", error.URL, error.MaxBytes)
+}
+
+// ChecksumMismatchError reports a downloaded file whose digest differs from DownloadOptions.Checksum.
+type ChecksumMismatchError struct {
+	Filename string
+	Expected string // "algorithm:hex"
+	Actual   string
+}
+
+func (error ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("Checksum mismatch of %v: expected %v, actual %v", error.Filename, error.Expected, error.Actual)
+}
+
 type LoginError struct {
 	Message string
 }
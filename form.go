@@ -2,10 +2,15 @@ package scraper
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
 	"net/http"
 	"net/url"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -21,16 +26,20 @@ func (error FormElementNotFoundError) Error() string {
 
 // AvailableValue holds an available value and corresponding label to display.
 type AvailableValue struct {
-	Value string
-	Label string
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
 }
 
 // FormElement holds a form element.
 type FormElement struct {
-	Type            string // "select", "hidden", "submit", "text", "email", "password", "button", "checkbox", "radio", "image"
+	Type            string // "select", "hidden", "submit", "text", "email", "password", "button", "checkbox", "radio", "image", "textarea", "file"
 	Name            string
 	Value           *AvailableValue
 	AvailableValues []*AvailableValue
+	Multiple        bool              // select[multiple] or checkboxes sharing the name
+	Values          []*AvailableValue // selected values of a Multiple element (Value is the first of them)
+	Files           []*FormFile       // files attached to a file element
+	Constraints     FormConstraints   // HTML5 constraint attributes checked by Form.Validate
 }
 
 func (element *FormElement) AddAvailableValue(val *AvailableValue) {
@@ -40,12 +49,52 @@ func (element *FormElement) AddAvailableValue(val *AvailableValue) {
 	element.AvailableValues = append(element.AvailableValues, val)
 }
 
+// setValues sets selected values of a Multiple element.
+func (element *FormElement) setValues(values []*AvailableValue) {
+	element.Values = values
+	if len(values) > 0 {
+		element.Value = values[0]
+	} else {
+		element.Value = nil
+	}
+}
+
+// selected reports whether val is selected.
+func (element *FormElement) selected(val *AvailableValue) bool {
+	if element.Multiple {
+		return slices.Contains(element.Values, val)
+	}
+	return element.Value == val
+}
+
+// submitValues returns values to be submitted.
+func (element *FormElement) submitValues() []string {
+	if element.Multiple {
+		values := make([]string, 0, len(element.Values))
+		for _, v := range element.Values {
+			values = append(values, v.Value)
+		}
+		return values
+	}
+	if element.Value == nil {
+		return nil
+	}
+	return []string{element.Value.Value}
+}
+
 func (element *FormElement) GoString() string {
 	buf := &bytes.Buffer{}
 	_, _ = fmt.Fprintf(buf, "FormElement{\n")
 	_, _ = fmt.Fprintf(buf, "  Type: %v\n", element.Type)
 	_, _ = fmt.Fprintf(buf, "  Name: %v\n", element.Name)
 	_, _ = fmt.Fprintf(buf, "  Value: %#v\n", element.Value)
+	if element.Multiple {
+		_, _ = fmt.Fprintf(buf, "  Values: [")
+		for _, a := range element.Values {
+			_, _ = fmt.Fprintf(buf, "%#v, ", a)
+		}
+		_, _ = fmt.Fprintf(buf, "]\n")
+	}
 	if element.AvailableValues != nil {
 		_, _ = fmt.Fprintf(buf, "  AvailableValues: [")
 		for _, a := range element.AvailableValues {
@@ -57,14 +106,106 @@ func (element *FormElement) GoString() string {
 	return buf.String()
 }
 
+// FormSubmitter holds a submit button of a form.
+type FormSubmitter struct {
+	Type    string // "submit" or "image"
+	Name    string // "" if the button has no name (nothing is sent for the button)
+	Value   string
+	Label   string // text of the button, or alt of the image
+	Action  string // formaction, overrides Form.Action if not empty
+	Method  string // formmethod, overrides Form.Method if not empty
+	Enctype string // formenctype, overrides Form.Enctype if not empty
+	// NoValidate is formnovalidate: submitting with this submitter skips Session.ValidateForm.
+	NoValidate bool
+}
+
+func newFormSubmitter(s *goquery.Selection, t string, name string, value string, label string) *FormSubmitter {
+	submitter := &FormSubmitter{
+		Type:   t,
+		Name:   name,
+		Value:  value,
+		Label:  label,
+		Action: s.AttrOr("formaction", ""),
+		Method: s.AttrOr("formmethod", ""),
+	}
+	if enctype, ok := s.Attr("formenctype"); ok {
+		submitter.Enctype = parseEnctype(enctype)
+	}
+	_, submitter.NoValidate = s.Attr("formnovalidate")
+	return submitter
+}
+
+// parseEnctype returns EnctypeMultipart or EnctypeURLEncoded (the default for other values).
+func parseEnctype(enctype string) string {
+	if strings.EqualFold(strings.TrimSpace(enctype), EnctypeMultipart) {
+		return EnctypeMultipart
+	}
+	return EnctypeURLEncoded
+}
+
+// formControlDisabled reports whether the form control s is disabled by itself or by an ancestor fieldset.
+// controls in the first legend of a disabled fieldset are not disabled.
+func formControlDisabled(s *goquery.Selection) bool {
+	if _, ok := s.Attr("disabled"); ok {
+		return true
+	}
+	fieldsets := s.ParentsFiltered("fieldset[disabled]")
+	for i := 0; i < fieldsets.Length(); i++ {
+		legend := fieldsets.Eq(i).ChildrenFiltered("legend").First()
+		if legend.Length() == 0 || !legend.Contains(s.Get(0)) {
+			return true
+		}
+	}
+	return false
+}
+
+// formControls returns the submittable controls whose form owner is form, in document order:
+// descendants of form without a form attribute, and controls anywhere with form="id of form".
+// disabled controls are excluded.
+func (page *Page) formControls(form *goquery.Selection) *goquery.Selection {
+	id, hasId := form.Attr("id")
+	return page.Find("input, textarea, select, button").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		if owner, ok := s.Attr("form"); ok {
+			if !hasId || owner != id {
+				return false
+			}
+		} else if !s.Closest("form").IsSelection(form) {
+			return false
+		}
+		return !formControlDisabled(s)
+	})
+}
+
 // Form holds form data and submit information
 type Form struct {
-	url      *url.URL
-	baseUrl  *url.URL
-	Action   string
-	Method   string
-	Elements map[string]*FormElement
-	Logger   Logger
+	url        *url.URL
+	baseUrl    *url.URL
+	Action     string
+	Method     string
+	Enctype    string // EnctypeURLEncoded or EnctypeMultipart
+	NoValidate bool   // novalidate: Session.ValidateForm is skipped
+	Elements   map[string]*FormElement
+	Submitters []*FormSubmitter // submit buttons in document order
+	Logger     Logger
+	// Encoding encodes submitted values: the first supported charset of accept-charset,
+	// or the encoding of the page. nil means Session.Encoding, or UTF-8 if it is nil too.
+	Encoding  encoding.Encoding
+	submitter *FormSubmitter // chosen by SetSubmitter
+	initial   url.Values     // values as parsed from the page, for the diff printed by ShowFormPosting
+}
+
+// labelOf returns the text of label[for=id] of the element s.
+func (page *Page) labelOf(s *goquery.Selection) string {
+	if id, ok := s.Attr("id"); ok {
+		idEscaped := strings.Replace(id, ".", "\\002e", -1)
+		idEscaped = strings.Replace(idEscaped, ":", "\\003a", -1)
+		//session.Printf("id %v -> %v\n", id, idEscaped)
+		label := page.Find(fmt.Sprintf("label[for=%s]", idEscaped))
+		if label.Length() > 0 {
+			return label.Text()
+		}
+	}
+	return ""
 }
 
 // Form generates a Form object from a form object identified by selector in the Page
@@ -76,25 +217,8 @@ func (page *Page) Form(selector string) (*Form, error) {
 	}
 
 	elements := map[string]*FormElement{}
-	inputs := form.Find("input")
-	for i := 0; i < inputs.Length(); i++ {
-		s := inputs.Eq(i)
-		name, ok := s.Attr("name")
-		if !ok {
-			t, ok := s.Attr("type")
-			if !ok || t != "submit" {
-				page.Logger.Printf("an input element without name (%#v) found. ignore.", s)
-			}
-			continue
-		}
-		t, ok := s.Attr("type")
-		if !ok {
-			t = "text"
-		}
-		value, ok := s.Attr("value")
-		if !ok && strings.ToLower(t) == "radio" {
-			value = "on"
-		}
+	var submitters []*FormSubmitter
+	getElement := func(name string, t string) *FormElement {
 		element, ok := elements[name]
 		if !ok {
 			element = &FormElement{
@@ -103,95 +227,238 @@ func (page *Page) Form(selector string) (*Form, error) {
 			}
 			elements[name] = element
 		}
+		return element
+	}
 
-		val := &AvailableValue{
-			Value: value,
-		}
-		if id, ok := s.Attr("id"); ok {
-			idEscaped := strings.Replace(id, ".", "\\002e", -1)
-			idEscaped = strings.Replace(idEscaped, ":", "\\003a", -1)
-			//session.Printf("id %v -> %v\n", id, idEscaped)
-			label := page.Find(fmt.Sprintf("label[for=%s]", idEscaped))
-			if label.Length() > 0 {
-				val.Label = label.Text()
+	controls := page.formControls(form)
+	for i := 0; i < controls.Length(); i++ {
+		s := controls.Eq(i)
+		switch goquery.NodeName(s) {
+		case "input":
+			page.formInput(s, getElement, &submitters)
+		case "textarea":
+			if name, ok := s.Attr("name"); ok {
+				element := getElement(name, "textarea")
+				element.Value = &AvailableValue{Value: s.Text(), Label: page.labelOf(s)}
+				parseFormConstraints(s, &element.Constraints)
+			}
+		case "select":
+			if name, ok := s.Attr("name"); ok {
+				element := getElement(name, "select")
+				formSelect(s, element)
+				parseFormConstraints(s, &element.Constraints)
+			}
+		case "button":
+			t, ok := s.Attr("type")
+			if ok && strings.ToLower(t) != "submit" {
+				continue // "button" and "reset" are never submitted
 			}
+			name, _ := s.Attr("name")
+			value, _ := s.Attr("value")
+			submitters = append(submitters, newFormSubmitter(s, "submit", name, value, strings.TrimSpace(s.Text())))
 		}
+	}
 
-		switch strings.ToLower(t) {
-		case "submit", "hidden", "button", "text", "email", "password", "image":
-			element.Value = val
+	action, _ := form.Attr("action")
+
+	method, ok := form.Attr("method")
+	if !ok {
+		method = "get"
+	}
+	enctype := parseEnctype(form.AttrOr("enctype", ""))
+	_, noValidate := form.Attr("novalidate")
+	formEncoding := page.Encoding
+	if acceptCharset, ok := form.Attr("accept-charset"); ok {
+		if e := acceptCharsetEncoding(acceptCharset); e != nil {
+			formEncoding = e
+		}
+	}
+	f := &Form{
+		url:        page.Url,
+		baseUrl:    page.BaseUrl,
+		Action:     action,
+		Method:     method,
+		Enctype:    enctype,
+		NoValidate: noValidate,
+		Encoding:   formEncoding,
+		Elements:   elements,
+		Submitters: submitters,
+		Logger:     page.Logger,
+	}
+	f.initial = f.comparableValues(nil)
+	return f, nil
+}
+
+func (page *Page) formInput(s *goquery.Selection, getElement func(name string, t string) *FormElement, submitters *[]*FormSubmitter) {
+	t, ok := s.Attr("type")
+	if !ok {
+		t = "text"
+	}
+	name, hasName := s.Attr("name")
+	value, ok := s.Attr("value")
+	if !ok && (strings.ToLower(t) == "radio" || strings.ToLower(t) == "checkbox") {
+		value = "on"
+	}
+
+	switch strings.ToLower(t) {
+	case "submit":
+		*submitters = append(*submitters, newFormSubmitter(s, "submit", name, value, value))
+	case "image":
+		alt, _ := s.Attr("alt")
+		*submitters = append(*submitters, newFormSubmitter(s, "image", name, "", alt))
+	}
+
+	if !hasName {
+		if strings.ToLower(t) != "submit" {
+			page.Logger.Printf("an input element without name (%#v) found. ignore.", s)
+		}
+		return
+	}
+	element := getElement(name, t)
+	parseFormConstraints(s, &element.Constraints)
+
+	val := &AvailableValue{
+		Value: value,
+		Label: page.labelOf(s),
+	}
 
-		case "checkbox":
+	switch strings.ToLower(t) {
+	case "submit", "hidden", "button", "text", "email", "password", "image",
+		"search", "tel", "url", "number", "range", "color", "date", "month", "week", "time", "datetime-local":
+		element.Value = val
+
+	case "checkbox":
+		_, checked := s.Attr("checked")
+		if element.AvailableValues == nil {
 			element.AvailableValues = []*AvailableValue{val}
-			if _, checked := s.Attr("checked"); checked {
+			if checked {
 				element.Value = val
 			}
-
-		case "radio":
-			element.AddAvailableValue(val)
-			if _, ok := s.Attr("checked"); ok {
-				element.Value = val
-			} else if element.Value == nil {
-				element.Value = val // select first item by default
+			break
+		}
+		// checkboxes sharing the name
+		if !element.Multiple {
+			element.Multiple = true
+			if element.Value != nil {
+				element.Values = []*AvailableValue{element.Value}
 			}
 		}
+		element.AddAvailableValue(val)
+		if checked {
+			element.setValues(append(element.Values, val))
+		}
+
+	case "radio":
+		element.AddAvailableValue(val)
+		if _, ok := s.Attr("checked"); ok {
+			element.Value = val
+		} else if element.Value == nil {
+			element.Value = val // select first item by default
+		}
+
+	case "file":
+		_, element.Multiple = s.Attr("multiple")
 	}
+}
 
-	selects := form.Find("select")
-	for i := 0; i < selects.Length(); i++ {
-		s := selects.Eq(i)
+func formSelect(s *goquery.Selection, element *FormElement) {
+	_, element.Multiple = s.Attr("multiple")
+	options := s.Find("option")
+	for j := 0; j < options.Length(); j++ {
+		o := options.Eq(j)
 
-		name, ok := s.Attr("name")
+		value, ok := o.Attr("value")
 		if !ok {
+			// ignore an option without value
 			continue
 		}
+		if _, disabled := o.Attr("disabled"); disabled || o.ParentsFiltered("optgroup[disabled]").Length() > 0 {
+			continue // disabled options can not be selected
+		}
+		val := &AvailableValue{
+			Value: value,
+			Label: o.Text(),
+		}
+		element.AddAvailableValue(val)
 
-		element, ok := elements[name]
-		if !ok {
-			element = &FormElement{
-				Type: "select",
-				Name: name,
+		_, selected := o.Attr("selected")
+		if element.Multiple {
+			if selected {
+				element.setValues(append(element.Values, val))
 			}
-			elements[name] = element
+			continue
+		}
+		if selected {
+			element.Value = val
 		}
-		options := s.Find("option")
-		for j := 0; j < options.Length(); j++ {
-			o := options.Eq(j)
+		if element.Value == nil {
+			element.Value = val // select first item by default
+		}
+	}
+}
 
-			value, ok := o.Attr("value")
-			if !ok {
-				// ignore an option without value
-				continue
-			}
-			val := &AvailableValue{
-				Value: value,
-				Label: o.Text(),
-			}
-			element.AddAvailableValue(val)
+// acceptCharsetEncoding returns the encoding of the first supported charset in accept-charset,
+// or nil if none is supported.
+func acceptCharsetEncoding(acceptCharset string) encoding.Encoding {
+	labels := strings.FieldsFunc(acceptCharset, func(r rune) bool { return r == ' ' || r == ',' })
+	for _, label := range labels {
+		switch strings.ToLower(label) {
+		case "utf-8", "utf8", "unicode-1-1-utf-8":
+			return unicode.UTF8
+		}
+		if e := getEncodingFromCharset(label); e != nil {
+			return e
+		}
+	}
+	return nil
+}
 
-			if _, ok := o.Attr("selected"); ok {
-				element.Value = val
-			}
-			if element.Value == nil {
-				element.Value = val // select first item by default
+// encodeValues converts names and values of data to e.
+func encodeValues(data url.Values, e encoding.Encoding) (url.Values, error) {
+	encoder := e.NewEncoder()
+	encoded := make(url.Values, len(data))
+	for name, values := range data {
+		encodedName, _, err := transform.String(encoder, name)
+		if err != nil {
+			return nil, FormEncodingError{Name: name, Value: name, Encoding: e, Err: err}
+		}
+		for _, v := range values {
+			encodedValue, _, err := transform.String(encoder, v)
+			if err != nil {
+				return nil, FormEncodingError{Name: name, Value: v, Encoding: e, Err: err}
 			}
+			encoded[encodedName] = append(encoded[encodedName], encodedValue)
 		}
 	}
+	return encoded, nil
+}
 
-	action, _ := form.Attr("action")
+// SetSubmitter chooses the submit button to be sent by name and value.
+// an empty value matches any value. Only the chosen submitter is sent;
+// without SetSubmitter, values of named input[type=submit] are sent as before.
+func (form *Form) SetSubmitter(name string, value string) error {
+	submitter, err := form.findSubmitter(name, value, "")
+	if err != nil {
+		return err
+	}
+	form.submitter = submitter
+	return nil
+}
 
-	method, ok := form.Attr("method")
-	if !ok {
-		method = "get"
+// findSubmitter returns the first submitter matching name, value and label.
+// empty arguments match anything.
+func (form *Form) findSubmitter(name string, value string, label string) (*FormSubmitter, error) {
+	for _, submitter := range form.Submitters {
+		if (name == "" || submitter.Name == name) &&
+			(value == "" || submitter.Value == value) &&
+			(label == "" || submitter.Label == strings.TrimSpace(label)) {
+			return submitter, nil
+		}
+	}
+	if name == "" {
+		return nil, FormElementNotFoundError{label}
 	}
-	return &Form{
-		url:      page.Url,
-		baseUrl:  page.BaseUrl,
-		Action:   action,
-		Method:   method,
-		Elements: elements,
-		Logger:   page.Logger,
-	}, nil
+	return nil, FormElementNotFoundError{name}
 }
 
 // Set sets a value to the element specified by name.
@@ -218,8 +485,34 @@ func (form *Form) Set(name string, value string) error {
 			}
 			return fmt.Errorf("value %v is not available in [%s]", value, strings.Join(availableOptions, ", "))
 		}
-		element.Value = found
+		if element.Multiple {
+			element.setValues([]*AvailableValue{found})
+		} else {
+			element.Value = found
+		}
+	}
+	return nil
+}
+
+// SetValues sets values to the Multiple element (select[multiple] or checkboxes sharing the name) specified by name.
+// each value must be one of AvailableValues.
+func (form *Form) SetValues(name string, values ...string) error {
+	element, ok := form.Elements[name]
+	if !ok {
+		return FormElementNotFoundError{name}
+	}
+	if !element.Multiple {
+		return fmt.Errorf("form element %v does not accept multiple values", name)
+	}
+	selected := make([]*AvailableValue, 0, len(values))
+	for _, value := range values {
+		i := slices.IndexFunc(element.AvailableValues, func(val *AvailableValue) bool { return val.Value == value })
+		if i < 0 {
+			return fmt.Errorf("value %v is not available in form element %v", value, name)
+		}
+		selected = append(selected, element.AvailableValues[i])
 	}
+	element.setValues(selected)
 	return nil
 }
 
@@ -284,7 +577,7 @@ func (form *Form) PrintSelection(name string) error {
 
 	for _, value := range element.AvailableValues {
 		mark := " "
-		if element.Value == value {
+		if element.selected(value) {
 			mark = "*"
 		}
 		form.Logger.Printf(" %v %#v (%#v)\n", mark, value.Label, value.Value)
@@ -298,7 +591,7 @@ func (form *Form) Unset(name string) error {
 	if !ok {
 		return FormElementNotFoundError{name}
 	}
-	element.Value = nil
+	element.setValues(nil)
 	return nil
 }
 
@@ -322,6 +615,7 @@ func (form *Form) NumSelect(name string) (int, error) {
 }
 
 // Select sets an answer to the select element specified by name.
+// for a Multiple element, the answer is added to the selected values.
 func (form *Form) Select(name string, index int) error {
 	element, ok := form.Elements[name]
 	if !ok {
@@ -330,72 +624,205 @@ func (form *Form) Select(name string, index int) error {
 	if index < 0 || index >= len(element.AvailableValues) {
 		return fmt.Errorf("select out of range %v in %#v", index, element.AvailableValues)
 	}
-	element.Value = element.AvailableValues[index]
+	val := element.AvailableValues[index]
+	if element.Multiple {
+		if !element.selected(val) {
+			element.setValues(append(element.Values, val))
+		}
+		return nil
+	}
+	element.Value = val
 	return nil
 }
 
-// SubmitOpt submits a form.
+// values returns names and values to be submitted with submitter (nil for the legacy behavior),
+// clicking an image at (x, y). without submitter, only the image named imageId is sent if not empty.
+// files are not included.
+func (form *Form) values(submitter *FormSubmitter, imageId string, x int, y int) url.Values {
+	data := url.Values{}
+	imageKey := func(name string, member string) string {
+		if name == "" {
+			return member
+		}
+		return name + "." + member
+	}
+	for name, element := range form.Elements {
+		if submitter != nil && (element.Type == "submit" || element.Type == "image") {
+			continue // only the chosen submitter is sent
+		}
+		if element.Type == "file" {
+			continue // sent by writeMultipart
+		}
+		if element.Type == "image" {
+			if element.Value != nil && (imageId == "" || element.Name == imageId) {
+				data.Set(imageKey(name, "x"), strconv.Itoa(x))
+				data.Set(imageKey(name, "y"), strconv.Itoa(y))
+			}
+			continue
+		}
+		for _, value := range element.submitValues() {
+			data.Add(name, value)
+		}
+	}
+	if submitter != nil {
+		switch {
+		case submitter.Type == "image":
+			data.Set(imageKey(submitter.Name, "x"), strconv.Itoa(x))
+			data.Set(imageKey(submitter.Name, "y"), strconv.Itoa(y))
+		case submitter.Name != "":
+			data.Add(submitter.Name, submitter.Value)
+		}
+	}
+	return data
+}
+
+// SubmitOption holds per-submission options of SubmitOptContext.
+type SubmitOption struct {
+	RequestOption
+
+	// Name, Value and Label choose the submitter (a submit button or an image) to imitate clicking,
+	// overriding Form.SetSubmitter. empty fields match anything; Name or Label must be set to choose.
+	Name  string
+	Value string
+	Label string
+	X, Y  int // click coordinates on an image submitter
+
+	Action string // overrides the action of the form and the submitter if not empty
+	Method string // overrides the method of the form and the submitter if not empty
+}
+
+// Submit submits a form.
 func (session *Session) Submit(form *Form) (*Response, error) {
-	return session.SubmitOpt(form, "")
+	return session.SubmitOptContext(context.Background(), form, SubmitOption{})
+}
+
+// SubmitContext submits a form with ctx.
+func (session *Session) SubmitContext(ctx context.Context, form *Form) (*Response, error) {
+	return session.SubmitOptContext(ctx, form, SubmitOption{})
 }
 
 // SubmitOpt submits a form.
-// if imageId is non-empty, specifies "image" element to imitate clicking.
+// if imageId is non-empty, specifies "image" element to imitate clicking:
+// other images are not sent, and submit buttons are sent as Submit does.
+// an imageId matching no element is ignored.
+// use SubmitOptContext to choose a single submitter and click coordinates.
 func (session *Session) SubmitOpt(form *Form, imageId string) (*Response, error) {
-	m := map[string]string{}
-	for name, element := range form.Elements {
-		if element.Value != nil {
-			if element.Type == "image" {
-				if imageId == "" || element.Name == imageId {
-					key := func(member string) string {
-						if name == "" {
-							return member
-						}
-						return name + "." + member
-					}
-					m[key("x")] = "0"
-					m[key("y")] = "0"
-				}
-			} else {
-				m[name] = element.Value.Value
-			}
+	return session.submit(context.Background(), form, form.submitter, imageId, SubmitOption{})
+}
+
+// SubmitOptContext submits a form with ctx and opt.
+func (session *Session) SubmitOptContext(ctx context.Context, form *Form, opt SubmitOption) (*Response, error) {
+	submitter := form.submitter
+	if opt.Name != "" || opt.Label != "" {
+		var err error
+		if submitter, err = form.findSubmitter(opt.Name, opt.Value, opt.Label); err != nil {
+			return nil, err
 		}
 	}
+	return session.submit(ctx, form, submitter, "", opt)
+}
+
+// submit submits form with submitter. imageId is the legacy image of SubmitOpt.
+func (session *Session) submit(ctx context.Context, form *Form, submitter *FormSubmitter, imageId string, opt SubmitOption) (*Response, error) {
+	if session.ValidateForm && !form.NoValidate && (submitter == nil || !submitter.NoValidate) {
+		if violations := form.Validate(); len(violations) > 0 {
+			return nil, FormValidationError{violations}
+		}
+	}
+
+	data := form.values(submitter, imageId, opt.X, opt.Y)
 
 	if session.ShowFormPosting {
 		form.Logger.Printf("Form Posting:{\n")
-		keys := make([]string, 0, len(m))
-		for k := range m {
+		keys := make([]string, 0, len(data))
+		for k := range data {
 			keys = append(keys, k)
 		}
 		sort.Strings(keys)
 		for _, k := range keys {
-			form.Logger.Printf(" %v=%v\n", k, m[k])
+			for _, v := range data[k] {
+				form.Logger.Printf(" %v=%v\n", k, session.Redactor.formValue(k, v))
+			}
+		}
+		names := make([]string, 0)
+		for name, element := range form.Elements {
+			if len(element.Files) > 0 {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, file := range form.Elements[name].Files {
+				form.Logger.Printf(" %v=@%v (%v)\n", name, file.Filename, file.ContentType)
+			}
 		}
 		form.Logger.Printf("}\n")
+		if diffs := diffValues(form.initial, form.comparableValues(submitter)); form.initial != nil && diffs != nil {
+			form.printDiff("Form Diff from page", diffs, session.Redactor)
+		}
 	}
 
-	if session.Encoding != nil {
+	formEncoding := form.Encoding
+	if formEncoding == nil {
+		formEncoding = session.Encoding
+	}
+	if formEncoding != nil {
 		if session.ShowFormPosting {
-			form.Logger.Printf("converting to %v...\n", session.Encoding)
+			form.Logger.Printf("converting to %v...\n", formEncoding)
 		}
-		encoder := session.Encoding.NewEncoder()
-		for k, v := range m {
-			m[k], _, _ = transform.String(encoder, v)
+		var err error
+		if data, err = encodeValues(data, formEncoding); err != nil {
+			return nil, err
 		}
 	}
 
-	data := url.Values{}
-	for k, v := range m {
-		data.Set(k, v)
+	action, method, enctype := form.Action, form.Method, form.Enctype
+	if submitter != nil {
+		if submitter.Action != "" {
+			action = submitter.Action
+		}
+		if submitter.Method != "" {
+			method = submitter.Method
+		}
+		if submitter.Enctype != "" {
+			enctype = submitter.Enctype
+		}
+	}
+	if opt.Action != "" {
+		action = opt.Action
+	}
+	if opt.Method != "" {
+		method = opt.Method
 	}
 
-	reqUrl, _ := form.baseUrl.Parse(form.Action)
-	encoded := data.Encode()
-	req, _ := http.NewRequest(strings.ToUpper(form.Method), reqUrl.String(), bytes.NewBufferString(encoded))
-	req.Header.Set("Content-type", "application/x-www-form-urlencoded")
+	reqUrl, _ := form.baseUrl.Parse(action)
+	if method == "" || strings.EqualFold(method, http.MethodGet) {
+		// the fields replace the query of the action, as browsers do
+		reqUrl.RawQuery = data.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqUrl.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Referer", form.url.String())
+		return session.invokeOpt(req, opt.RequestOption)
+	}
+	body := bytes.NewBufferString(data.Encode())
+	contentType := EnctypeURLEncoded
+	if enctype == EnctypeMultipart && strings.EqualFold(method, http.MethodPost) {
+		// files are not needed to replay the request
+		var err error
+		if body, contentType, err = form.writeMultipart(data, session.NotUseNetwork); err != nil {
+			return nil, err
+		}
+	}
+	length := body.Len()
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), reqUrl.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-type", contentType)
 	req.Header.Set("Referer", form.url.String())
-	req.Header.Set("Content-length", strconv.Itoa(len(encoded)))
+	req.Header.Set("Content-length", strconv.Itoa(length))
 	//req.Header.Set("Origin", reqUrl.Scheme + "://" + reqUrl.Host)
-	return session.invoke(req)
+	return session.invokeOpt(req, opt.RequestOption)
 }
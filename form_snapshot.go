@@ -0,0 +1,194 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/text/transform"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// FormSnapshot is a JSON serializable snapshot of a Form.
+type FormSnapshot struct {
+	URL        string                `json:"url,omitempty"` // URL of the page of the form
+	Action     string                `json:"action"`
+	Method     string                `json:"method"`
+	Enctype    string                `json:"enctype,omitempty"`
+	Encoding   string                `json:"encoding,omitempty"`
+	Elements   []FormElementSnapshot `json:"elements"` // sorted by name
+	Submitters []*FormSubmitter      `json:"submitters,omitempty"`
+	Submitter  *FormSubmitter        `json:"submitter,omitempty"` // chosen by SetSubmitter
+}
+
+// FormElementSnapshot is a JSON serializable snapshot of a FormElement.
+type FormElementSnapshot struct {
+	Type            string            `json:"type"`
+	Name            string            `json:"name"`
+	Values          []string          `json:"values"` // values to be submitted
+	AvailableValues []*AvailableValue `json:"available_values,omitempty"`
+	Files           []string          `json:"files,omitempty"` // filenames of attached files
+}
+
+// Snapshot returns the current state of the form.
+func (form *Form) Snapshot() FormSnapshot {
+	snapshot := FormSnapshot{
+		Action:     form.Action,
+		Method:     form.Method,
+		Enctype:    form.Enctype,
+		Elements:   make([]FormElementSnapshot, 0, len(form.Elements)),
+		Submitters: form.Submitters,
+		Submitter:  form.submitter,
+	}
+	if form.url != nil {
+		snapshot.URL = form.url.String()
+	}
+	if form.Encoding != nil {
+		snapshot.Encoding = fmt.Sprint(form.Encoding)
+	}
+	for _, name := range form.elementNames() {
+		element := form.Elements[name]
+		values := element.submitValues()
+		if values == nil {
+			values = []string{}
+		}
+		e := FormElementSnapshot{
+			Type:            element.Type,
+			Name:            name,
+			Values:          values,
+			AvailableValues: element.AvailableValues,
+		}
+		for _, file := range element.Files {
+			e.Files = append(e.Files, file.Filename)
+		}
+		snapshot.Elements = append(snapshot.Elements, e)
+	}
+	return snapshot
+}
+
+// MarshalJSON encodes Snapshot of the form.
+func (form *Form) MarshalJSON() ([]byte, error) {
+	return json.Marshal(form.Snapshot())
+}
+
+func (form *Form) elementNames() []string {
+	names := make([]string, 0, len(form.Elements))
+	for name := range form.Elements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// comparableValues returns values to be submitted with submitter,
+// with attached files as "file:" + filename like multipartFields.
+func (form *Form) comparableValues(submitter *FormSubmitter) url.Values {
+	values := form.values(submitter, "", 0, 0)
+	for name, element := range form.Elements {
+		for _, file := range element.Files {
+			values.Add(name, "file:"+file.Filename)
+		}
+	}
+	return values
+}
+
+// FormDiff is a difference of submitted values of a field.
+type FormDiff struct {
+	Name string
+	A    []string // values of the first form (nil if not submitted)
+	B    []string // values of the second form or the request body (nil if not submitted)
+}
+
+func (diff FormDiff) String() string {
+	switch {
+	case diff.A == nil:
+		return fmt.Sprintf("+ %v=%v", diff.Name, strings.Join(diff.B, ","))
+	case diff.B == nil:
+		return fmt.Sprintf("- %v=%v", diff.Name, strings.Join(diff.A, ","))
+	default:
+		return fmt.Sprintf("~ %v=%v -> %v", diff.Name, strings.Join(diff.A, ","), strings.Join(diff.B, ","))
+	}
+}
+
+// DiffForms compares values to be submitted by a and b (with their chosen submitters).
+// returns differences sorted by name, or nil if they are the same.
+func DiffForms(a *Form, b *Form) []FormDiff {
+	return diffValues(a.comparableValues(a.submitter), b.comparableValues(b.submitter))
+}
+
+// DiffRequestBody compares values to be submitted by the form with a captured request body
+// (e.g. copied from developer tools of a browser) of contentType,
+// application/x-www-form-urlencoded or multipart/form-data.
+// the body is decoded with form.Encoding. uploaded files are compared by filenames.
+func (form *Form) DiffRequestBody(contentType string, body []byte) ([]FormDiff, error) {
+	var captured url.Values
+	if boundary, ok := isMultipart(contentType); ok {
+		fields, _, err := multipartFields(boundary, body)
+		if err != nil {
+			return nil, err
+		}
+		captured = fields
+	} else {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		captured = values
+	}
+	if form.Encoding != nil {
+		decoded := make(url.Values, len(captured))
+		for name, values := range captured {
+			decodedName, _, err := transform.String(form.Encoding.NewDecoder(), name)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range values {
+				decodedValue, _, err := transform.String(form.Encoding.NewDecoder(), v)
+				if err != nil {
+					return nil, err
+				}
+				decoded.Add(decodedName, decodedValue)
+			}
+		}
+		captured = decoded
+	}
+	return diffValues(form.comparableValues(form.submitter), captured), nil
+}
+
+func diffValues(a url.Values, b url.Values) []FormDiff {
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []FormDiff
+	for _, name := range names {
+		if !slices.Equal(a[name], b[name]) {
+			diffs = append(diffs, FormDiff{Name: name, A: a[name], B: b[name]})
+		}
+	}
+	return diffs
+}
+
+// printDiff prints diffs with values masked by redactor.
+func (form *Form) printDiff(title string, diffs []FormDiff, redactor *Redactor) {
+	form.Logger.Printf("%v:{\n", title)
+	for _, diff := range diffs {
+		masked := FormDiff{Name: diff.Name}
+		for _, v := range diff.A {
+			masked.A = append(masked.A, redactor.formValue(diff.Name, v))
+		}
+		for _, v := range diff.B {
+			masked.B = append(masked.B, redactor.formValue(diff.Name, v))
+		}
+		form.Logger.Printf(" %v\n", masked)
+	}
+	form.Logger.Printf("}\n")
+}
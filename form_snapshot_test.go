@@ -0,0 +1,111 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/text/encoding/japanese"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const snapshotFormHtml = `<form action='/post' method='post'>
+<input type='hidden' name='token' value='abc'>
+<input name='user' value=''>
+<input type='password' name='password'>
+<select name='plan'><option value='free'>Free</option><option value='pro'>Pro</option></select>
+<input type='submit' name='ok' value='OK'>
+</form>`
+
+func TestForm_MarshalJSON(t *testing.T) {
+	form, err := newFormTestPage(t, snapshotFormHtml).Form("form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot FormSnapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Action != "/post" || snapshot.Method != "post" || len(snapshot.Elements) != 5 {
+		t.Errorf("snapshot = %s", b)
+	}
+	plan := snapshot.Elements[2]
+	if plan.Name != "plan" || fmt.Sprint(plan.Values) != "[free]" || len(plan.AvailableValues) != 2 || plan.AvailableValues[1].Label != "Pro" {
+		t.Errorf("plan = %+v", plan)
+	}
+	if !strings.Contains(string(b), `"available_values":[{"value":"free","label":"Free"}`) {
+		t.Errorf("json = %s", b)
+	}
+}
+
+func TestForm_Diff(t *testing.T) {
+	page := newFormTestPage(t, snapshotFormHtml)
+	a, err := page.Form("form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := page.Form("form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := DiffForms(a, b); diffs != nil {
+		t.Errorf("same forms: %v", diffs)
+	}
+
+	_ = b.Set("user", "koizuka")
+	_ = b.Set("plan", "pro")
+	_ = b.Unset("token")
+	var got []string
+	for _, diff := range DiffForms(a, b) {
+		got = append(got, diff.String())
+	}
+	if want := []string{"~ plan=free -> pro", "- token=abc", "~ user= -> koizuka"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("diffs = %q, want %q", got, want)
+	}
+
+	a.Encoding = japanese.ShiftJIS
+	diffs, err := a.DiffRequestBody("application/x-www-form-urlencoded", []byte("token=abc&user=%93%FA%96%7B&password=&plan=free&ok=OK&extra=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = got[:0]
+	for _, diff := range diffs {
+		got = append(got, diff.String())
+	}
+	if want := []string{"+ extra=1", "~ user= -> 日本"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("diffs with body = %q, want %q", got, want)
+	}
+}
+
+func TestSession_ShowFormPostingDiff(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	form, err := newFormTestPage(t, snapshotFormHtml).Form("form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form.baseUrl = mustParseURL(t, ts.URL)
+	form.url = form.baseUrl
+	logger := &BufferedLogger{}
+	form.Logger = logger
+	_ = form.Set("password", "secret")
+
+	session := NewSession("form_diff", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	session.ShowFormPosting = true
+	session.Redactor = &Redactor{FormFields: []string{"password"}}
+	if _, err := session.Submit(form); err != nil {
+		t.Fatal(err)
+	}
+	if log := logger.String(); !strings.Contains(log, "Form Diff from page:{\n ~ password=[REDACTED] -> [REDACTED]\n}") {
+		t.Errorf("log = %v", log)
+	}
+}
@@ -2,8 +2,16 @@ package scraper
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/encoding/japanese"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -113,6 +121,30 @@ func TestFormPage(t *testing.T) {
 			map[string]string{"name1": "label1"},
 			map[string]int{"name1": 2},
 		},
+		{
+			"textarea with label",
+			"<form><label for='id1'>label1</label><textarea id='id1' name='name1'>line1\nline2</textarea></form>",
+			"form",
+			map[string]string{"name1": "line1\nline2"},
+			map[string]string{"name1": "label1"},
+			map[string]int{"name1": 0},
+		},
+		{
+			"select multiple without select -> no value",
+			"<form><select name='name1' multiple><option value='value1'>label1</option><option value='value2'>label2</option></select></form>",
+			"form",
+			map[string]string{},
+			map[string]string{},
+			map[string]int{"name1": 2},
+		},
+		{
+			"checkboxes sharing name -> first checked one",
+			"<form><input type='checkbox' name='name1' value='value1'><input type='checkbox' name='name1' value='value2' checked><input type='checkbox' name='name1' value='value3' checked></form>",
+			"form",
+			map[string]string{"name1": "value2"},
+			map[string]string{},
+			map[string]int{"name1": 3},
+		},
 	}
 
 	testUrl, err := url.Parse("http://localhost/")
@@ -129,7 +161,7 @@ func TestFormPage(t *testing.T) {
 			t.Error(err)
 		}
 
-		page := &Page{doc, testUrl, logger}
+		page := &Page{Document: doc, BaseUrl: testUrl, Logger: logger}
 
 		form, err := page.Form(test.FormSelector)
 		if err != nil {
@@ -180,7 +212,7 @@ func TestFormSetErrorMessage(t *testing.T) {
 		t.Error(err)
 	}
 
-	page := &Page{doc, testUrl, logger}
+	page := &Page{Document: doc, BaseUrl: testUrl, Logger: logger}
 	form, err := page.Form("form")
 	if err != nil {
 		t.Error(err)
@@ -197,3 +229,488 @@ func TestFormSetErrorMessage(t *testing.T) {
 		t.Errorf("Error message should contain readable value/label pairs, got: %s", errorMessage)
 	}
 }
+
+func newFormTestPage(t *testing.T, html string) *Page {
+	t.Helper()
+	testUrl, err := url.Parse("http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewBufferString(html))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Page{Document: doc, BaseUrl: testUrl, Logger: &DummyLogger{}}
+}
+
+// submitTestForm submits form to a test server and returns the posted values.
+func submitTestForm(t *testing.T, form *Form) url.Values {
+	t.Helper()
+	var posted url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		posted = r.PostForm
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	form.baseUrl, _ = url.Parse(ts.URL)
+	form.url = form.baseUrl
+	form.Action = "/post"
+	form.Method = "post"
+
+	session := NewSession("form_submit", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	if _, err := session.Submit(form); err != nil {
+		t.Fatal(err)
+	}
+	return posted
+}
+
+func TestForm_MultipleValues(t *testing.T) {
+	page := newFormTestPage(t, `<form>
+<select name='s' multiple><option value='a'>A</option><option value='b' selected>B</option><option value='c' selected>C</option></select>
+<input type='checkbox' name='c' value='1'><input type='checkbox' name='c' value='2'>
+<input type='checkbox' name='single'>
+</form>`)
+	form, err := page.Form("form")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := form.Elements["s"]
+	if !s.Multiple || len(s.Values) != 2 || s.Value.Value != "b" {
+		t.Errorf("select multiple: %#v", s)
+	}
+	if form.Elements["single"].Multiple {
+		t.Error("a single checkbox should not be Multiple")
+	}
+
+	if err := form.Select("s", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.Check("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.Select("c", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.SetValues("s", "x"); err == nil {
+		t.Error("SetValues with unavailable value should fail")
+	}
+	if err := form.SetValues("single", "on"); err == nil {
+		t.Error("SetValues to a single element should fail")
+	}
+
+	posted := submitTestForm(t, form)
+	if got := posted["s"]; !slices.Equal(got, []string{"b", "c", "a"}) {
+		t.Errorf("s = %v", got)
+	}
+	if got := posted["c"]; !slices.Equal(got, []string{"1", "2"}) {
+		t.Errorf("c = %v", got)
+	}
+	if _, ok := posted["single"]; ok {
+		t.Errorf("unchecked checkbox posted: %v", posted)
+	}
+
+	if err := form.Set("s", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.Unset("c"); err != nil {
+		t.Fatal(err)
+	}
+	posted = submitTestForm(t, form)
+	if got := posted["s"]; !slices.Equal(got, []string{"a"}) {
+		t.Errorf("s after Set = %v", got)
+	}
+	if _, ok := posted["c"]; ok {
+		t.Errorf("c after Unset = %v", posted["c"])
+	}
+
+	if err := form.SetValues("s"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Value != nil {
+		t.Errorf("Value after SetValues() = %#v", s.Value)
+	}
+}
+
+func TestForm_Submitters(t *testing.T) {
+	html := `<form>
+<input type='hidden' name='h' value='hidden'>
+<textarea name='t'>text</textarea>
+<input type='submit' name='ok' value='OK'>
+<button name='action' value='save'>Save <b>draft</b></button>
+<button type='submit' name='action' value='publish'>Publish</button>
+<button type='button' name='preview' value='1'>Preview</button>
+<button type='reset'>Reset</button>
+</form>`
+
+	t.Run("submitters", func(t *testing.T) {
+		form, err := newFormTestPage(t, html).Form("form")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var labels []string
+		for _, s := range form.Submitters {
+			labels = append(labels, s.Label)
+		}
+		if !slices.Equal(labels, []string{"OK", "Save draft", "Publish"}) {
+			t.Errorf("submitters = %v", labels)
+		}
+		if _, ok := form.Elements["action"]; ok {
+			t.Error("button should not be in Elements")
+		}
+		if err := form.SetSubmitter("missing", ""); err == nil {
+			t.Error("SetSubmitter with unknown name should fail")
+		}
+	})
+
+	t.Run("legacy without submitter", func(t *testing.T) {
+		form, err := newFormTestPage(t, html).Form("form")
+		if err != nil {
+			t.Fatal(err)
+		}
+		posted := submitTestForm(t, form)
+		want := url.Values{"h": {"hidden"}, "t": {"text"}, "ok": {"OK"}}
+		if posted.Encode() != want.Encode() {
+			t.Errorf("posted = %v, want %v", posted, want)
+		}
+	})
+
+	t.Run("chosen submitter", func(t *testing.T) {
+		form, err := newFormTestPage(t, html).Form("form")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := form.SetSubmitter("action", "publish"); err != nil {
+			t.Fatal(err)
+		}
+		posted := submitTestForm(t, form)
+		want := url.Values{"h": {"hidden"}, "t": {"text"}, "action": {"publish"}}
+		if posted.Encode() != want.Encode() {
+			t.Errorf("posted = %v, want %v", posted, want)
+		}
+	})
+}
+
+func TestForm_FormOwner(t *testing.T) {
+	page := newFormTestPage(t, `<html><body>
+<input name='outside' value='no'>
+<input name='associated' value='yes' form='f1'>
+<form id='f1' action='/default' method='get'>
+<input name='enabled' value='1'>
+<input name='disabled' value='1' disabled>
+<input name='other' value='1' form='f2'>
+<fieldset disabled>
+<legend><input name='legend' value='1'></legend>
+<input name='fieldset' value='1'>
+<legend><input name='legend2' value='1'></legend>
+</fieldset>
+<select name='s'><option value='a' disabled>A</option><optgroup label='g' disabled><option value='b'>B</option></optgroup><option value='c'>C</option></select>
+<button name='go' value='1' formaction='/override' formmethod='post' formenctype='multipart/form-data'>Go</button>
+<button name='off' value='1' disabled>Off</button>
+</form>
+<form id='f2'></form>
+<button form='f1' name='external' value='1'>External</button>
+</body></html>`)
+	form, err := page.Form("#f1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for name := range form.Elements {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if want := []string{"associated", "enabled", "legend", "s"}; !slices.Equal(names, want) {
+		t.Errorf("elements = %v, want %v", names, want)
+	}
+	if s := form.Elements["s"]; len(s.AvailableValues) != 1 || s.Value.Value != "c" {
+		t.Errorf("select = %#v", s)
+	}
+
+	var submitters []string
+	for _, s := range form.Submitters {
+		submitters = append(submitters, s.Name)
+	}
+	if want := []string{"go", "external"}; !slices.Equal(submitters, want) {
+		t.Errorf("submitters = %v, want %v", submitters, want)
+	}
+	if submitter := form.Submitters[0]; submitter.Action != "/override" || submitter.Method != "post" || submitter.Enctype != EnctypeMultipart {
+		t.Errorf("submitter = %#v", submitter)
+	}
+
+	var got *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Error(err)
+		}
+		got = r
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+	form.baseUrl = mustParseURL(t, ts.URL)
+	form.url = form.baseUrl
+	if err := form.SetSubmitter("go", ""); err != nil {
+		t.Fatal(err)
+	}
+	session := NewSession("form_owner", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	if _, err := session.Submit(form); err != nil {
+		t.Fatal(err)
+	}
+	if got.Method != http.MethodPost || got.URL.Path != "/override" {
+		t.Errorf("request = %v %v", got.Method, got.URL)
+	}
+	want := url.Values{"associated": {"yes"}, "enabled": {"1"}, "legend": {"1"}, "s": {"c"}, "go": {"1"}}
+	if posted := url.Values(got.MultipartForm.Value); posted.Encode() != want.Encode() {
+		t.Errorf("posted = %v, want %v", posted, want)
+	}
+}
+
+func TestSession_SubmitOption(t *testing.T) {
+	var got *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		got = r
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	html := `<form action='/transfer' method='post'>
+<input type='hidden' name='h' value='1'>
+<input type='submit' name='op' value='confirm'>
+<input type='submit' name='op' value='cancel'>
+<input type='image' name='map' alt='Map'>
+<button name='op' value='back'>戻る</button>
+</form>`
+	session := NewSession("submit_option", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	submit := func(opt SubmitOption) url.Values {
+		t.Helper()
+		form, err := newFormTestPage(t, html).Form("form")
+		if err != nil {
+			t.Fatal(err)
+		}
+		form.baseUrl = mustParseURL(t, ts.URL)
+		form.url = form.baseUrl
+		if _, err := session.SubmitOptContext(context.Background(), form, opt); err != nil {
+			t.Fatal(err)
+		}
+		return got.Form
+	}
+
+	tests := []struct {
+		title string
+		opt   SubmitOption
+		want  url.Values
+	}{
+		{"by name and value", SubmitOption{Name: "op", Value: "cancel"}, url.Values{"h": {"1"}, "op": {"cancel"}}},
+		{"by label", SubmitOption{Label: "戻る"}, url.Values{"h": {"1"}, "op": {"back"}}},
+		{"image with coordinates", SubmitOption{Name: "map", X: 12, Y: 34}, url.Values{"h": {"1"}, "map.x": {"12"}, "map.y": {"34"}}},
+		{"image by alt", SubmitOption{Label: "Map"}, url.Values{"h": {"1"}, "map.x": {"0"}, "map.y": {"0"}}},
+	}
+	for _, tt := range tests {
+		if posted := submit(tt.opt); posted.Encode() != tt.want.Encode() {
+			t.Errorf("%v: posted = %v, want %v", tt.title, posted, tt.want)
+		}
+	}
+
+	submit(SubmitOption{Name: "op", Value: "confirm", Action: "/other?a=1", Method: "get"})
+	if got.Method != http.MethodGet || got.URL.Path != "/other" {
+		t.Errorf("override: %v %v", got.Method, got.URL)
+	}
+
+	form, err := newFormTestPage(t, html).Form("form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.SubmitOptContext(context.Background(), form, SubmitOption{Name: "missing"}); err == nil {
+		t.Error("unknown submitter should fail")
+	}
+
+}
+
+func TestSession_SubmitOpt(t *testing.T) {
+	var got *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		got = r
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	html := `<form action='/search' method='post'>
+<input type='hidden' name='h' value='1'>
+<input type='submit' name='go' value='Go'>
+<input type='image' name='img'>
+<input type='image' name='other'>
+</form>`
+	session := NewSession("submit_opt", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+
+	// submit buttons are sent with the image, and an unknown imageId is ignored
+	tests := []struct {
+		imageId string
+		want    string
+	}{
+		{"img", "go=Go&h=1&img.x=0&img.y=0"},
+		{"missing", "go=Go&h=1"},
+	}
+	for _, tt := range tests {
+		form, err := newFormTestPage(t, html).Form("form")
+		if err != nil {
+			t.Fatal(err)
+		}
+		form.baseUrl = mustParseURL(t, ts.URL)
+		form.url = form.baseUrl
+		if _, err := session.SubmitOpt(form, tt.imageId); err != nil {
+			t.Fatalf("SubmitOpt(%q): %v", tt.imageId, err)
+		}
+		if posted := got.PostForm.Encode(); posted != tt.want {
+			t.Errorf("SubmitOpt(%q): posted = %v, want %v", tt.imageId, posted, tt.want)
+		}
+	}
+}
+
+func TestSession_SubmitGet(t *testing.T) {
+	var got *http.Request
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got, body = r, string(b)
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	html := `<form action='/search?old=1' method='post'>
+<input type='hidden' name='q' value='日本'>
+<button name='go' value='1' formmethod='get'>Go</button>
+</form>`
+	session := NewSession("submit_get", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	form, err := newFormTestPage(t, html).Form("form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form.baseUrl = mustParseURL(t, ts.URL)
+	form.url = form.baseUrl
+	if err := form.SetSubmitter("go", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Submit(form); err != nil {
+		t.Fatal(err)
+	}
+	if got.Method != http.MethodGet || got.URL.Path != "/search" || got.URL.RawQuery != "go=1&q=%E6%97%A5%E6%9C%AC" {
+		t.Errorf("request = %v %v", got.Method, got.URL)
+	}
+	if body != "" || got.Header.Get("Content-Type") != "" || got.ContentLength != 0 {
+		t.Errorf("GET has a body %q (Content-Type %q)", body, got.Header.Get("Content-Type"))
+	}
+}
+
+func TestSession_SubmitRequestOption(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Requested-With") != "XMLHttpRequest" {
+			t.Errorf("per-call header is not sent: %v", r.Header)
+		}
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<html><body>login failed</body></html>")
+	}))
+	defer ts.Close()
+
+	session := NewSession("submit_request_option", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	form, err := newFormTestPage(t, `<form action='/login' method='post'><input name='id' value='alice'></form>`).Form("form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form.baseUrl = mustParseURL(t, ts.URL)
+	form.url = form.baseUrl
+	resp, err := session.SubmitOptContext(context.Background(), form, SubmitOption{RequestOption: RequestOption{
+		AcceptErrorStatus: true,
+		Header:            http.Header{"X-Requested-With": {"XMLHttpRequest"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(string(resp.RawBody), "login failed") {
+		t.Errorf("response = %v %q", resp.StatusCode, resp.RawBody)
+	}
+}
+
+func TestForm_Encoding(t *testing.T) {
+	var rawQuery string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rawQuery = string(body)
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	html := `<html><head><meta charset="Shift_JIS"></head><body>
+<form id='page' method='post'><input name='q' value='日本'></form>
+<form id='utf8' method='post' accept-charset='utf-8'><input name='q' value='日本'></form>
+<form id='euc' method='post' accept-charset='unknown EUC-JP'><input name='q' value='日本'></form>
+</body></html>`
+	response, err := createHtmlResponse(html, japanese.ShiftJIS, nil, ts.URL, "text/html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := response.Page()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Encoding != japanese.ShiftJIS {
+		t.Errorf("page.Encoding = %v", page.Encoding)
+	}
+
+	session := NewSession("form_encoding", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	submit := func(selector string) error {
+		form, err := page.Form(selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = session.Submit(form)
+		return err
+	}
+
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"#page", "q=%93%FA%96%7B"},
+		{"#utf8", "q=%E6%97%A5%E6%9C%AC"},
+		{"#euc", "q=%C6%FC%CB%DC"},
+	}
+	for _, tt := range tests {
+		if err := submit(tt.selector); err != nil {
+			t.Fatal(err)
+		}
+		if rawQuery != tt.want {
+			t.Errorf("%v: posted %v, want %v", tt.selector, rawQuery, tt.want)
+		}
+	}
+
+	form, err := page.Form("#page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := form.Set("q", "😀"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = session.Submit(form)
+	var encodingError FormEncodingError
+	if !errors.As(err, &encodingError) || encodingError.Name != "q" || encodingError.Value != "😀" {
+		t.Errorf("err = %v", err)
+	}
+}
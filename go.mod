@@ -4,11 +4,13 @@ go 1.26.0
 
 require (
 	github.com/PuerkitoBio/goquery v1.12.0
+	github.com/andybalholm/brotli v1.2.0
 	github.com/chromedp/cdproto v0.0.0-20260321001828-e3e3800016bc
 	github.com/chromedp/chromedp v0.15.1
 	github.com/dimchansky/utfbom v1.1.1
 	github.com/google/go-cmp v0.7.0
 	github.com/orirawlings/persistent-cookiejar v0.3.2
+	golang.org/x/net v0.52.0
 	golang.org/x/text v0.41.0
 )
 
@@ -21,7 +23,6 @@ require (
 	github.com/gobwas/ws v1.4.0 // indirect
 	github.com/kr/text v0.1.0 // indirect
 	go4.org v0.0.0-20190313082347-94abd6928b1d // indirect
-	golang.org/x/net v0.52.0 // indirect
 	golang.org/x/sys v0.42.0 // indirect
 	gopkg.in/retry.v1 v1.0.0-20161025181430-c09f6b86ba4d // indirect
 )
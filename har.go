@@ -0,0 +1,427 @@
+package scraper
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR 1.2 structures. see http://www.softwareishard.com/blog/har-12-spec/
+// only the fields used by this package are declared.
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	BodyHash    string         `json:"_bodyHash,omitempty"` // custom field: SHA-256 of the recorded body, preferred to postData for matching
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// chromeResponse is a subset of network.Response saved as N.html.response.json by ChromeSession.
+type chromeResponse struct {
+	URL            string         `json:"url"`
+	Status         int            `json:"status"`
+	StatusText     string         `json:"statusText"`
+	Headers        map[string]any `json:"headers"`
+	MimeType       string         `json:"mimeType"`
+	RequestHeaders map[string]any `json:"requestHeaders"`
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	list := []harNameValue{}
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range header[k] {
+			list = append(list, harNameValue{k, v})
+		}
+	}
+	return list
+}
+
+func chromeHeaders(headers map[string]any) http.Header {
+	header := http.Header{}
+	for k, v := range headers {
+		// Chrome joins multiple values with newlines
+		for _, value := range strings.Split(fmt.Sprint(v), "\n") {
+			header.Add(k, value)
+		}
+	}
+	return header
+}
+
+func httpHeader(list []harNameValue) http.Header {
+	header := http.Header{}
+	for _, nv := range list {
+		if strings.HasPrefix(nv.Name, ":") {
+			continue // HTTP/2 pseudo headers
+		}
+		header.Add(nv.Name, nv.Value)
+	}
+	return header
+}
+
+func harQueryString(rawURL string) []harNameValue {
+	list := []harNameValue{}
+	if u, err := url.Parse(rawURL); err == nil {
+		query := u.Query()
+		keys := make([]string, 0, len(query))
+		for k := range query {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, v := range query[k] {
+				list = append(list, harNameValue{k, v})
+			}
+		}
+	}
+	return list
+}
+
+func newHarResponse(statusCode int, header http.Header) harResponse {
+	return harResponse{
+		Status:      statusCode,
+		StatusText:  http.StatusText(statusCode),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(header),
+		RedirectURL: header.Get("Location"),
+		HeadersSize: -1,
+	}
+}
+
+// newHarPostData returns postData of the recorded request, or nil if it has no body.
+func newHarPostData(request *RecordedRequest, requestHeader http.Header) *harPostData {
+	if request == nil || request.Body == "" {
+		return nil
+	}
+	text := request.Body
+	if request.BodyEncoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return nil
+		}
+		text = string(decoded)
+	}
+	mimeType := requestHeader.Get("Content-Type")
+	if _, ok := isMultipart(mimeType); ok {
+		mimeType = EnctypeURLEncoded // recorded as the fields without the files
+	}
+	return &harPostData{MimeType: mimeType, Text: text}
+}
+
+func newHarEntry(started time.Time, method string, rawURL string, requestHeader http.Header, bodyHash string, postData *harPostData, response harResponse) harEntry {
+	bodySize := -1
+	if postData != nil {
+		bodySize = len(postData.Text)
+	}
+	return harEntry{
+		StartedDateTime: started.Format("2006-01-02T15:04:05.000Z07:00"),
+		Request: harRequest{
+			Method:      method,
+			URL:         rawURL,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(requestHeader),
+			QueryString: harQueryString(rawURL),
+			PostData:    postData,
+			HeadersSize: -1,
+			BodySize:    bodySize,
+			BodyHash:    bodyHash,
+		},
+		Response: response,
+	}
+}
+
+// ExportHAR writes the recorded session directory (N.html with .meta and
+// Chrome's .response.json files) to w as a HAR 1.2 file.
+// redirect hops are exported as separate entries.
+func (session *Session) ExportHAR(w io.Writer) error {
+	dirname := session.getDirectory()
+	entries, err := os.ReadDir(dirname)
+	if err != nil {
+		return err
+	}
+	numbers := map[int]string{}
+	var keys []int
+	for _, entry := range entries {
+		if match := recordFilenameRegexp.FindStringSubmatch(entry.Name()); match != nil {
+			n, _ := strconv.Atoi(match[1])
+			numbers[n] = entry.Name()
+			keys = append(keys, n)
+		}
+	}
+	sort.Ints(keys)
+
+	har := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "github.com/koizuka/scraper", Version: strconv.Itoa(PageMetadataVersion)},
+		Entries: []harEntry{},
+	}}
+	for _, n := range keys {
+		filename := path.Join(dirname, numbers[n])
+		body, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		metadata, err := loadPageMetadata(filename)
+		if err != nil {
+			session.Printf("%s HAR: skip %v: %v\n", session.getDebugPrefix(), filename, err)
+			continue
+		}
+		if metadata.CompressedBody {
+			if body, err = decodeContent(metadata.ContentEncoding, body); err != nil {
+				session.Printf("%s HAR: skip %v: %v\n", session.getDebugPrefix(), filename, err)
+				continue
+			}
+		}
+		started := time.Now()
+		if info, err := os.Stat(filename); err == nil {
+			started = info.ModTime()
+		}
+
+		statusCode := metadata.StatusCode
+		header := metadata.Header
+		requestHeader := metadata.RequestHeader
+		if jsonData, err := os.ReadFile(filename + ".response.json"); err == nil {
+			var chrome chromeResponse
+			if json.Unmarshal(jsonData, &chrome) == nil {
+				if statusCode == 0 {
+					statusCode = chrome.Status
+				}
+				if header == nil {
+					header = chromeHeaders(chrome.Headers)
+				}
+				if requestHeader == nil && chrome.RequestHeaders != nil {
+					requestHeader = chromeHeaders(chrome.RequestHeaders)
+				}
+			}
+		}
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		if header == nil {
+			header = http.Header{}
+			if metadata.ContentType != "" {
+				header.Set("Content-Type", metadata.ContentType)
+			}
+		}
+
+		method := metadata.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		bodyHash := ""
+		postData := newHarPostData(metadata.Request, requestHeader)
+		if metadata.Request != nil {
+			bodyHash = metadata.Request.BodyHash
+		}
+		for i, hop := range metadata.Redirects {
+			hopMethod, hopHash, hopPostData := http.MethodGet, "", (*harPostData)(nil)
+			if i == 0 && metadata.Request != nil {
+				hopMethod, hopHash, hopPostData = metadata.Request.Method, bodyHash, postData
+			}
+			har.Log.Entries = append(har.Log.Entries,
+				newHarEntry(started, hopMethod, hop.URL, requestHeader, hopHash, hopPostData, newHarResponse(hop.StatusCode, hop.Header)))
+		}
+		if len(metadata.Redirects) > 0 {
+			bodyHash, postData = "", nil
+		}
+
+		response := newHarResponse(statusCode, header)
+		response.Content = harContent{Size: len(body), MimeType: metadata.ContentType}
+		if utf8.Valid(body) {
+			response.Content.Text = string(body)
+		} else {
+			response.Content.Text = base64.StdEncoding.EncodeToString(body)
+			response.Content.Encoding = "base64"
+		}
+		response.BodySize = len(body)
+		har.Log.Entries = append(har.Log.Entries, newHarEntry(started, method, metadata.URL, requestHeader, bodyHash, postData, response))
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(har)
+}
+
+// harReplay serves responses from HAR entries in NotUseNetwork mode.
+type harReplay struct {
+	filename string
+	entries  []harEntry
+	used     []bool
+}
+
+// LoadHAR loads a HAR file as the replay source of the session.
+// while a HAR is loaded, requests in NotUseNetwork mode are matched with
+// HAR entries by method, normalized URL and body (ReplayIgnoreParams applies),
+// instead of the files in the session directory.
+func (session *Session) LoadHAR(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return fmt.Errorf("failed to parse HAR file %s: %v", filename, err)
+	}
+	session.harReplay = &harReplay{
+		filename: filename,
+		entries:  har.Log.Entries,
+		used:     make([]bool, len(har.Log.Entries)),
+	}
+	return nil
+}
+
+// recordedRequest returns RecordedRequest of the entry masked by redactor, like newRecordedRequest.
+func (entry *harEntry) recordedRequest(redactor *Redactor) RecordedRequest {
+	bodyHash := entry.Request.BodyHash
+	if bodyHash == "" && entry.Request.PostData != nil && entry.Request.PostData.Text != "" {
+		bodyHash, _ = hashRequestBody(entry.Request.PostData.MimeType, []byte(entry.Request.PostData.Text), redactor)
+	}
+	return RecordedRequest{Method: entry.Request.Method, URL: redactor.url(entry.Request.URL), BodyHash: bodyHash}
+}
+
+// find returns the index of the first unused entry matching key.
+func (replay *harReplay) find(key string, ignoreParams []string, redactor *Redactor) int {
+	for i := range replay.entries {
+		if !replay.used[i] && replay.entries[i].recordedRequest(redactor).key(ignoreParams) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// lookup returns the response body and metadata for request, following redirect entries.
+func (replay *harReplay) lookup(request *RecordedRequest, ignoreParams []string, redactor *Redactor) ([]byte, PageMetadata, error) {
+	var metadata PageMetadata
+	i := replay.find(request.key(ignoreParams), ignoreParams, redactor)
+	if i < 0 {
+		return nil, metadata, fmt.Errorf("%v is not in %v", request, replay.filename)
+	}
+
+	var redirects []RedirectHop
+	for {
+		replay.used[i] = true
+		entry := &replay.entries[i]
+		header := httpHeader(entry.Response.Headers)
+		location := entry.Response.RedirectURL
+		if location == "" {
+			location = header.Get("Location")
+		}
+		if entry.Response.Status/100 == 3 && location != "" && len(redirects) < 10 {
+			if base, err := url.Parse(entry.Request.URL); err == nil {
+				if target, err := base.Parse(location); err == nil {
+					next := RecordedRequest{Method: http.MethodGet, URL: redactor.url(target.String())}
+					if j := replay.find(next.key(ignoreParams), ignoreParams, redactor); j >= 0 {
+						redirects = append(redirects, RedirectHop{URL: entry.Request.URL, StatusCode: entry.Response.Status, Header: header})
+						i = j
+						continue
+					}
+				}
+			}
+		}
+
+		body := []byte(entry.Response.Content.Text)
+		if entry.Response.Content.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Response.Content.Text)
+			if err != nil {
+				return nil, metadata, fmt.Errorf("invalid base64 content of %v: %v", entry.Request.URL, err)
+			}
+			body = decoded
+		}
+		contentType := header.Get("Content-Type")
+		if contentType == "" {
+			contentType = entry.Response.Content.MimeType
+		}
+		metadata = PageMetadata{
+			Version:       PageMetadataVersion,
+			URL:           entry.Request.URL,
+			ContentType:   contentType,
+			StatusCode:    entry.Response.Status,
+			Header:        header,
+			Method:        entry.Request.Method,
+			RequestHeader: httpHeader(entry.Request.Headers),
+			Redirects:     redirects,
+		}
+		return body, metadata, nil
+	}
+}
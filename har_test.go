@@ -0,0 +1,197 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSession_ExportAndLoadHAR(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/top", http.StatusFound)
+	})
+	mux.HandleFunc("/top", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><form method="post" action="/login"><input name="id" value=""></form></body></html>`)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><body>hello %v</body></html>", r.FormValue("id"))
+	})
+	mux.HandleFunc("/binary", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write([]byte{0xff, 0xfe, 0x00, 0x01})
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	record := NewSession("har", &BufferedLogger{})
+	record.FilePrefix = dir + "/"
+	record.SaveToFile = true
+
+	page, err := record.GetPage(ts.URL + "/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := record.FormAction(page, "form", map[string]string{"id": "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := record.Get(ts.URL + "/binary"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := record.ExportHAR(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var har harFile
+	if err := json.Unmarshal(buf.Bytes(), &har); err != nil {
+		t.Fatal(err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 4 {
+		t.Fatalf("unexpected HAR: version %v, %v entries", har.Log.Version, len(har.Log.Entries))
+	}
+	if e := har.Log.Entries[0]; e.Response.Status != http.StatusFound || e.Response.RedirectURL != "/top" {
+		t.Errorf("redirect entry = %+v", e.Response)
+	}
+	if e := har.Log.Entries[2]; e.Request.PostData == nil || e.Request.PostData.Text != "id=alice" || e.Request.PostData.MimeType != EnctypeURLEncoded {
+		t.Errorf("postData = %+v", e.Request.PostData)
+	}
+	if e := har.Log.Entries[0]; e.Request.PostData != nil {
+		t.Errorf("GET has postData: %+v", e.Request.PostData)
+	}
+	if e := har.Log.Entries[3]; e.Response.Content.Encoding != "base64" {
+		t.Errorf("binary content is not base64 encoded: %+v", e.Response.Content)
+	}
+
+	harFilename := path.Join(dir, "session.har")
+	if err := os.WriteFile(harFilename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	replay := NewSession("har_replay", &BufferedLogger{})
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	if err := replay.LoadHAR(harFilename); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = replay.GetPage(ts.URL + "/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.BaseUrl.String() != ts.URL+"/top" {
+		t.Errorf("BaseUrl = %v", page.BaseUrl)
+	}
+	resp, err := replay.FormAction(page, "form", map[string]string{"id": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(resp.RawBody), "hello alice") {
+		t.Errorf("body = %q", resp.RawBody)
+	}
+	resp, err = replay.Get(ts.URL + "/binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(resp.RawBody, []byte{0xff, 0xfe, 0x00, 0x01}) {
+		t.Errorf("binary body = %v", resp.RawBody)
+	}
+
+	// a different form value is not in the HAR
+	replay.Rewind()
+	page, err = replay.GetPage(ts.URL + "/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = replay.FormAction(page, "form", map[string]string{"id": "bob"})
+	var mismatch ReplayMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Errorf("expected ReplayMismatchError, got %v", err)
+	}
+}
+
+func TestSession_LoadHAR_Devtools(t *testing.T) {
+	// a capture as saved by browser devtools: includes sub resources and postData
+	const har = `{"log":{"version":"1.2","creator":{"name":"WebInspector","version":"537.36"},"entries":[
+{"startedDateTime":"2024-01-01T00:00:00.000Z","time":1,"request":{"method":"GET","url":"https://example.com/style.css","httpVersion":"http/2.0","headers":[],"queryString":[],"cookies":[],"headersSize":-1,"bodySize":0},
+ "response":{"status":200,"statusText":"","httpVersion":"http/2.0","headers":[{"name":"content-type","value":"text/css"}],"cookies":[],"content":{"size":0,"mimeType":"text/css","text":"body{}"},"redirectURL":"","headersSize":-1,"bodySize":0},"cache":{},"timings":{"send":0,"wait":0,"receive":0}},
+{"startedDateTime":"2024-01-01T00:00:01.000Z","time":1,"request":{"method":"POST","url":"https://example.com/search?t=1","httpVersion":"http/2.0","headers":[{"name":":authority","value":"example.com"}],"queryString":[],"cookies":[],"headersSize":-1,"bodySize":3,"postData":{"mimeType":"application/x-www-form-urlencoded","text":"q=x"}},
+ "response":{"status":200,"statusText":"","httpVersion":"http/2.0","headers":[{"name":"content-type","value":"text/html; charset=utf-8"}],"cookies":[],"content":{"size":10,"mimeType":"text/html","text":"<p>found</p>"},"redirectURL":"","headersSize":-1,"bodySize":0},"cache":{},"timings":{"send":0,"wait":0,"receive":0}}
+]}}`
+	dir := t.TempDir()
+	harFilename := path.Join(dir, "devtools.har")
+	if err := os.WriteFile(harFilename, []byte(har), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	session := NewSession("devtools", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.NotUseNetwork = true
+	session.ReplayIgnoreParams = []string{"t"}
+	if err := session.LoadHAR(harFilename); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", "https://example.com/search?t=2", strings.NewReader("q=x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := session.invoke(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.RawBody) != "<p>found</p>" || resp.ContentType != "text/html; charset=utf-8" {
+		t.Errorf("unexpected response: %q %q", resp.ContentType, resp.RawBody)
+	}
+}
+
+func TestSession_LoadHAR_DevtoolsFormOrder(t *testing.T) {
+	// devtools records fields in the document order, while Submit sends them sorted by name
+	const har = `{"log":{"version":"1.2","creator":{"name":"WebInspector","version":"537.36"},"entries":[
+{"startedDateTime":"2024-01-01T00:00:00.000Z","time":1,"request":{"method":"POST","url":"https://example.com/login","httpVersion":"http/2.0","headers":[],"queryString":[],"cookies":[],"headersSize":-1,"bodySize":21,"postData":{"mimeType":"application/x-www-form-urlencoded","text":"z=1&user=alice&a=2+3"}},
+ "response":{"status":200,"statusText":"","httpVersion":"http/2.0","headers":[{"name":"content-type","value":"text/html; charset=utf-8"}],"cookies":[],"content":{"size":14,"mimeType":"text/html","text":"<p>welcome</p>"},"redirectURL":"","headersSize":-1,"bodySize":0},"cache":{},"timings":{"send":0,"wait":0,"receive":0}}
+]}}`
+	dir := t.TempDir()
+	harFilename := path.Join(dir, "devtools.har")
+	if err := os.WriteFile(harFilename, []byte(har), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	session := NewSession("devtools_form", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.NotUseNetwork = true
+	if err := session.LoadHAR(harFilename); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := createHtmlResponse(`<form method="post" action="/login">
+<input name="z" value="1"><input name="user" value="alice"><input name="a" value="2 3"></form>`, nil, nil, "https://example.com/", "text/html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := response.Page()
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := page.Form("form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := session.Submit(form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.RawBody) != "<p>welcome</p>" {
+		t.Errorf("unexpected response: %q", resp.RawBody)
+	}
+}
@@ -0,0 +1,81 @@
+package scraper
+
+import (
+	"golang.org/x/text/transform"
+	"net/http"
+)
+
+// Hook is a middleware around requests of Session (Get, Submit, OpenURL, Send, ...).
+// nil functions are skipped. BeforeRequest runs in the order of Session.Hooks,
+// AfterResponse and OnError run in the reverse order.
+type Hook struct {
+	// BeforeRequest is called before req is sent, or before its recording is looked up in NotUseNetwork mode.
+	// it may modify req (e.g. add signing headers or rewrite the URL); built-in and Session.Header
+	// headers are already set in network mode. returning an error aborts the request.
+	BeforeRequest func(session *Session, req *http.Request) error
+	// AfterResponse is called with the response received or loaded from the recording.
+	// it may modify resp (e.g. RawBody). returning an error fails the request.
+	AfterResponse func(session *Session, resp *Response) error
+	// OnError is called when the request fails, including errors of other hooks.
+	// the returned error replaces err; returning nil keeps err.
+	OnError func(session *Session, req *http.Request, err error) error
+}
+
+// BodyFilterHook returns a Hook which applies filter to the decoded body of every response,
+// like Session.BodyFilter does for parsed pages.
+// the filtered body is encoded back to the encoding of the response.
+func BodyFilterHook(filter func(resp *Response, body []byte) ([]byte, error)) Hook {
+	return Hook{
+		AfterResponse: func(session *Session, resp *Response) error {
+			resp.DetectEncoding()
+			body, err := resp.Body()
+			if err != nil {
+				return err
+			}
+			if body, err = filter(resp, body); err != nil {
+				return err
+			}
+			if e := resp.bodyEncoding(); e != nil {
+				if body, _, err = transform.Bytes(e.NewEncoder(), body); err != nil {
+					return err
+				}
+			}
+			resp.RawBody = body
+			return nil
+		},
+	}
+}
+
+// invokeHooks runs Session.Hooks around invoke (invokeRequest or downloadRequest).
+func (session *Session) invokeHooks(req *http.Request, invoke func(req *http.Request) (*Response, error)) (*Response, error) {
+	for _, hook := range session.Hooks {
+		if hook.BeforeRequest != nil {
+			if err := hook.BeforeRequest(session, req); err != nil {
+				return nil, session.hookError(req, err)
+			}
+		}
+	}
+	resp, err := invoke(req)
+	if err != nil {
+		return nil, session.hookError(req, err)
+	}
+	for i := len(session.Hooks) - 1; i >= 0; i-- {
+		if hook := session.Hooks[i]; hook.AfterResponse != nil {
+			if err := hook.AfterResponse(session, resp); err != nil {
+				return nil, session.hookError(resp.Request, err)
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (session *Session) hookError(req *http.Request, err error) error {
+	for i := len(session.Hooks) - 1; i >= 0; i-- {
+		if hook := session.Hooks[i]; hook.OnError != nil {
+			if replaced := hook.OnError(session, req, err); replaced != nil {
+				err = replaced
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package scraper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/text/encoding/japanese"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSession_Hooks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "<html><body>%v %v</body></html>", r.URL.Path, r.Header.Get("X-Signature"))
+	}))
+	defer ts.Close()
+
+	var calls []string
+	hook := func(name string) Hook {
+		return Hook{
+			BeforeRequest: func(session *Session, req *http.Request) error {
+				calls = append(calls, name+".before")
+				return nil
+			},
+			AfterResponse: func(session *Session, resp *Response) error {
+				calls = append(calls, name+".after")
+				return nil
+			},
+			OnError: func(session *Session, req *http.Request, err error) error {
+				calls = append(calls, name+".error")
+				return nil
+			},
+		}
+	}
+	errWrapped := errors.New("wrapped")
+	sign := Hook{
+		BeforeRequest: func(session *Session, req *http.Request) error {
+			req.URL.Path = strings.Replace(req.URL.Path, "/old/", "/new/", 1)
+			req.Header.Set("X-Signature", "sig:"+strings.SplitN(req.Header.Get("User-Agent"), "/", 2)[0])
+			return nil
+		},
+		AfterResponse: func(session *Session, resp *Response) error {
+			resp.RawBody = bytes.ToUpper(resp.RawBody)
+			return nil
+		},
+		OnError: func(session *Session, req *http.Request, err error) error {
+			return fmt.Errorf("%w: %w", errWrapped, err)
+		},
+	}
+
+	dir := t.TempDir()
+	session := NewSession("hooks", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.SaveToFile = true
+	session.Hooks = []Hook{hook("a"), sign, hook("b")}
+
+	resp, err := session.Get(ts.URL + "/old/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := string(resp.RawBody); !strings.Contains(body, "/NEW/PAGE SIG:MOZILLA") {
+		t.Errorf("body = %v", body)
+	}
+	if want := "[a.before b.before b.after a.after]"; fmt.Sprint(calls) != want {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+
+	calls = nil
+	_, err = session.Get(ts.URL + "/error")
+	var responseError ResponseError
+	if !errors.Is(err, errWrapped) || !errors.As(err, &responseError) {
+		t.Errorf("err = %v", err)
+	}
+	if want := "[a.before b.before b.error a.error]"; fmt.Sprint(calls) != want {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+
+	// hooks run in replay mode, and the rewritten URL is replayed
+	replay := NewSession("hooks", &BufferedLogger{})
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	replay.ReplayMode = ReplayByRequest
+	replay.Hooks = session.Hooks
+	calls = nil
+	resp, err = replay.Get(ts.URL + "/old/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := string(resp.RawBody); !strings.Contains(body, "/NEW/PAGE") {
+		t.Errorf("replayed body = %v", body)
+	}
+	if want := "[a.before b.before b.after a.after]"; fmt.Sprint(calls) != want {
+		t.Errorf("replay calls = %v, want %v", calls, want)
+	}
+}
+
+func TestBodyFilterHook(t *testing.T) {
+	html, err := encode(`<html><head><meta charset="Shift_JIS"></head><body><p>旧</p></body></html>`, japanese.ShiftJIS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(html)
+	}))
+	defer ts.Close()
+
+	session := NewSession("body_filter_hook", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	session.Hooks = []Hook{BodyFilterHook(func(resp *Response, body []byte) ([]byte, error) {
+		return bytes.ReplaceAll(body, []byte("旧"), []byte("新")), nil
+	})}
+	page, err := session.GetPage(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := page.Find("p").Text(); text != "新" {
+		t.Errorf("text = %v", text)
+	}
+	if page.Encoding != japanese.ShiftJIS {
+		t.Errorf("page.Encoding = %v", page.Encoding)
+	}
+}
@@ -3,16 +3,32 @@ package scraper
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 )
 
 const MetadataFileExtension = ".meta"
 
+// PageMetadataVersion is the current version of the .meta file format.
+// version 1 (or no version field) has only URL, ContentType and Title.
+const PageMetadataVersion = 2
+
 // PageMetadata holds metadata for saved pages
 type PageMetadata struct {
-	URL         string `json:"url"`
-	ContentType string `json:"content_type"`
-	Title       string `json:"title,omitempty"`
+	Version       int              `json:"version,omitempty"`
+	URL           string           `json:"url"`
+	ContentType   string           `json:"content_type"`
+	Title         string           `json:"title,omitempty"`
+	StatusCode    int              `json:"status_code,omitempty"` // 0 = not recorded (treated as 200)
+	Header        http.Header      `json:"header,omitempty"`      // response headers
+	Method        string           `json:"method,omitempty"`
+	RequestHeader http.Header      `json:"request_header,omitempty"`
+	Redirects     []RedirectHop    `json:"redirects,omitempty"` // redirect responses before the final one
+	Request       *RecordedRequest `json:"request,omitempty"`   // the original request, for ReplayByRequest
+	File          string           `json:"file,omitempty"`      // file saved by Session.Download in the session directory, instead of the body in N.html
+	// ContentEncoding is the Content-Encoding of the response (e.g. "br"), decoded before the body is used.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	CompressedBody  bool   `json:"compressed_body,omitempty"` // the body file is saved as received, encoded with ContentEncoding
 }
 
 // savePageMetadata saves metadata to a .meta file
@@ -42,5 +58,8 @@ func loadPageMetadata(filename string) (PageMetadata, error) {
 	if err != nil {
 		return metadata, fmt.Errorf("failed to parse metadata file %s: %v", metadataFilename, err)
 	}
+	if metadata.Version > PageMetadataVersion {
+		return metadata, fmt.Errorf("unsupported metadata version %v in %s", metadata.Version, metadataFilename)
+	}
 	return metadata, nil
 }
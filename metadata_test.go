@@ -1,6 +1,7 @@
 package scraper
 
 import (
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
@@ -67,3 +68,60 @@ func TestLoadPageMetadata_Errors(t *testing.T) {
 		t.Error("Expected error when loading invalid JSON")
 	}
 }
+
+func TestLoadPageMetadata_Version(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Run("legacy file without version", func(t *testing.T) {
+		filename := filepath.Join(tempDir, "legacy.html")
+		err := os.WriteFile(filename+MetadataFileExtension, []byte(`{"url":"https://example.com/","content_type":"text/html"}`), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := loadPageMetadata(filename)
+		if err != nil {
+			t.Fatalf("Failed to load legacy metadata: %v", err)
+		}
+		want := PageMetadata{URL: "https://example.com/", ContentType: "text/html"}
+		if diff := cmp.Diff(want, loaded); diff != "" {
+			t.Errorf("Metadata mismatch (-expected +got):\n%s", diff)
+		}
+	})
+
+	t.Run("current version round trip", func(t *testing.T) {
+		filename := filepath.Join(tempDir, "current.html")
+		metadata := PageMetadata{
+			Version:       PageMetadataVersion,
+			URL:           "https://example.com/final",
+			ContentType:   "text/html",
+			StatusCode:    200,
+			Header:        http.Header{"Content-Disposition": {`attachment; filename="a.csv"`}},
+			Method:        "POST",
+			RequestHeader: http.Header{"Referer": {"https://example.com/"}},
+			Redirects: []RedirectHop{
+				{URL: "https://example.com/start", StatusCode: 302, Header: http.Header{"Location": {"/final"}}},
+			},
+		}
+		if err := savePageMetadata(filename, metadata); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := loadPageMetadata(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(metadata, loaded); diff != "" {
+			t.Errorf("Metadata mismatch (-expected +got):\n%s", diff)
+		}
+	})
+
+	t.Run("newer version is rejected", func(t *testing.T) {
+		filename := filepath.Join(tempDir, "future.html")
+		err := os.WriteFile(filename+MetadataFileExtension, []byte(`{"version":999,"url":"https://example.com/"}`), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadPageMetadata(filename); err == nil {
+			t.Error("Expected error for unsupported version")
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package scraper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// EnctypeURLEncoded is the default encoding type of a form.
+	EnctypeURLEncoded = "application/x-www-form-urlencoded"
+	// EnctypeMultipart is the encoding type of a form uploading files.
+	EnctypeMultipart = "multipart/form-data"
+)
+
+// FormFile is a file attached to a file element of a form.
+type FormFile struct {
+	Filename    string
+	ContentType string
+	Path        string    // read when the form is submitted unless Reader is set
+	Reader      io.Reader // read when the form is submitted
+}
+
+// AttachFile attaches the file at filePath to the file element specified by name.
+// the file is not read until the form is submitted, and not read at all in NotUseNetwork mode.
+func (form *Form) AttachFile(name string, filePath string) error {
+	contentType := mime.TypeByExtension(filepath.Ext(filePath))
+	return form.attach(name, &FormFile{
+		Filename:    filepath.Base(filePath),
+		ContentType: contentType,
+		Path:        filePath,
+	})
+}
+
+// AttachReader attaches the content of r as filename to the file element specified by name.
+// contentType may be empty to guess from filename.
+func (form *Form) AttachReader(name string, filename string, contentType string, r io.Reader) error {
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	return form.attach(name, &FormFile{
+		Filename:    filename,
+		ContentType: contentType,
+		Reader:      r,
+	})
+}
+
+func (form *Form) attach(name string, file *FormFile) error {
+	element, ok := form.Elements[name]
+	if !ok {
+		return FormElementNotFoundError{name}
+	}
+	if element.Type != "file" {
+		return fmt.Errorf("form element %v is not a file element: %v", name, element.Type)
+	}
+	if element.Multiple {
+		element.Files = append(element.Files, file)
+	} else {
+		element.Files = []*FormFile{file}
+	}
+	return nil
+}
+
+// open returns the content of the file.
+func (file *FormFile) open() (io.ReadCloser, error) {
+	if file.Reader != nil {
+		return io.NopCloser(file.Reader), nil
+	}
+	return os.Open(file.Path)
+}
+
+// writeMultipart encodes data and files of the form as multipart/form-data.
+// contents of the files are left empty if skipContent is set.
+func (form *Form) writeMultipart(data url.Values, skipContent bool) (body *bytes.Buffer, contentType string, err error) {
+	body = &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range data[k] {
+			if err := w.WriteField(k, v); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	names := make([]string, 0)
+	for name, element := range form.Elements {
+		if element.Type == "file" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		files := form.Elements[name].Files
+		if len(files) == 0 {
+			// browsers send an empty part for a file element without files
+			if _, err := createFormFile(w, name, &FormFile{}); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+		for _, file := range files {
+			part, err := createFormFile(w, name, file)
+			if err != nil {
+				return nil, "", err
+			}
+			if skipContent {
+				continue
+			}
+			r, err := file.open()
+			if err != nil {
+				return nil, "", err
+			}
+			_, err = io.Copy(part, r)
+			_ = r.Close()
+			if err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return body, w.FormDataContentType(), nil
+}
+
+func createFormFile(w *multipart.Writer, name string, file *FormFile) (io.Writer, error) {
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": name, "filename": file.Filename}))
+	h.Set("Content-Type", contentType)
+	return w.CreatePart(h)
+}
+
+// RecordedFile describes a file uploaded by a recorded request.
+type RecordedFile struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256,omitempty"`
+}
+
+// multipartFields returns fields of a multipart/form-data body for replay matching
+// with file contents replaced by their filenames, and the uploaded files.
+// the request can be matched without the files in NotUseNetwork mode.
+func multipartFields(boundary string, body []byte) (url.Values, []RecordedFile, error) {
+	fields := url.Values{}
+	var files []RecordedFile
+	r := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return fields, files, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := part.FormName()
+		if _, params, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition")); params != nil {
+			if filename, ok := params["filename"]; ok {
+				fields.Add(name, "file:"+filename)
+				if filename != "" {
+					file := RecordedFile{
+						Field:       name,
+						Filename:    filename,
+						ContentType: part.Header.Get("Content-Type"),
+						Size:        int64(len(content)),
+					}
+					if len(content) > 0 {
+						sum := sha256.Sum256(content)
+						file.SHA256 = hex.EncodeToString(sum[:])
+					}
+					files = append(files, file)
+				}
+				continue
+			}
+		}
+		fields.Add(name, string(content))
+	}
+}
+
+// isMultipart reports whether contentType is multipart/form-data and returns its boundary.
+func isMultipart(contentType string) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.EqualFold(mediaType, EnctypeMultipart) || params["boundary"] == "" {
+		return "", false
+	}
+	return params["boundary"], true
+}
@@ -0,0 +1,142 @@
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const uploadFormHtml = `<form action='/upload' method='post' enctype='multipart/form-data'>
+<input type='hidden' name='token' value='abc'>
+<input type='file' name='receipt'>
+<input type='file' name='attachments' multiple>
+</form>`
+
+func TestForm_Multipart(t *testing.T) {
+	type part struct{ filename, contentType, content string }
+	var got map[string][]part
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = map[string][]part{}
+		reader, err := r.MultipartReader()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for {
+			p, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			b, _ := io.ReadAll(p)
+			got[p.FormName()] = append(got[p.FormName()], part{p.FileName(), p.Header.Get("Content-Type"), string(b)})
+		}
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	form, err := newFormTestPage(t, uploadFormHtml).Form("form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Enctype != EnctypeMultipart {
+		t.Errorf("Enctype = %v", form.Enctype)
+	}
+	if err := form.AttachReader("token", "a.txt", "", strings.NewReader("x")); err == nil {
+		t.Error("AttachReader to a hidden element should fail")
+	}
+	if err := form.AttachReader("attachments", "a.txt", "", strings.NewReader("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.AttachReader("attachments", "b.bin", "application/x-test", strings.NewReader("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	form.baseUrl = mustParseURL(t, ts.URL)
+	form.url = form.baseUrl
+	session := NewSession("multipart", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	if _, err := session.Submit(form); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]part{
+		"token":       {{"", "", "abc"}},
+		"receipt":     {{"", "application/octet-stream", ""}},
+		"attachments": {{"a.txt", "text/plain; charset=utf-8", "first"}, {"b.bin", "application/x-test", "second"}},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("parts = %v, want %v", got, want)
+	}
+}
+
+func TestForm_MultipartReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, header, err := r.FormFile("receipt")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		fmt.Fprintf(w, "<html><body>%v %v</body></html>", r.FormValue("token"), header.Size)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	upload := path.Join(t.TempDir(), "receipt.pdf")
+	if err := os.WriteFile(upload, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	submit := func(session *Session, filePath string) (*Response, error) {
+		form, err := newFormTestPage(t, uploadFormHtml).Form("form")
+		if err != nil {
+			t.Fatal(err)
+		}
+		form.baseUrl = mustParseURL(t, ts.URL)
+		form.url = form.baseUrl
+		if err := form.AttachFile("receipt", filePath); err != nil {
+			t.Fatal(err)
+		}
+		return session.Submit(form)
+	}
+
+	record := NewSession("multipart_replay", &BufferedLogger{})
+	record.FilePrefix = dir + "/"
+	record.SaveToFile = true
+	resp, err := submit(record, upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := string(resp.RawBody); !strings.Contains(body, "abc 8") {
+		t.Errorf("body = %v", body)
+	}
+
+	metadata, err := loadPageMetadata(path.Join(dir, "multipart_replay", "1.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := metadata.Request.Files
+	if len(files) != 1 || files[0].Filename != "receipt.pdf" || files[0].ContentType != "application/pdf" || files[0].Size != 8 || files[0].SHA256 == "" {
+		t.Errorf("recorded files = %+v", files)
+	}
+
+	// the uploaded file is not needed to replay
+	replay := NewSession("multipart_replay", &BufferedLogger{})
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	replay.ReplayMode = ReplayByRequest
+	resp, err = submit(replay, path.Join(dir, "missing", "receipt.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := string(resp.RawBody); !strings.Contains(body, "abc 8") {
+		t.Errorf("replayed body = %v", body)
+	}
+}
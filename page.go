@@ -2,6 +2,7 @@ package scraper
 
 import (
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/encoding"
 	"net/url"
 	"regexp"
 )
@@ -9,8 +10,10 @@ import (
 // Page holds DOM structure of the page and its URL, Logging information.
 type Page struct {
 	*goquery.Document
-	BaseUrl *url.URL
-	Logger  Logger
+	BaseUrl        *url.URL
+	Logger         Logger
+	Encoding       encoding.Encoding // encoding of the source of the page (nil if UTF-8 or unknown)
+	EncodingSource EncodingSource    // how Encoding was determined
 }
 
 // MetaRefresh returns a URL from "meta http-equiv=refresh" tag if it exists.
@@ -0,0 +1,133 @@
+package scraper
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RateLimit holds politeness settings for a host.
+type RateLimit struct {
+	RequestsPerSecond float64       // maximum request rate (0 = unlimited)
+	MinDelay          time.Duration // minimum interval between requests (0 = none)
+	MaxConcurrent     int           // maximum number of in-flight requests (0 = unlimited)
+}
+
+// interval returns the minimum interval between request starts.
+func (limit RateLimit) interval() time.Duration {
+	interval := limit.MinDelay
+	if limit.RequestsPerSecond > 0 {
+		if d := time.Duration(float64(time.Second) / limit.RequestsPerSecond); d > interval {
+			interval = d
+		}
+	}
+	return interval
+}
+
+// RateLimiter enforces RateLimit per host.
+// A RateLimiter may be shared by several sessions to throttle them together.
+type RateLimiter struct {
+	Default RateLimit            // applied to hosts without their own limit
+	Hosts   map[string]RateLimit // limits per host ("example.com" or "example.com:8080")
+
+	mu    sync.Mutex
+	state map[string]*hostLimiter
+}
+
+type hostLimiter struct {
+	limit RateLimit
+	next  time.Time     // earliest time the next request may start
+	slots chan struct{} // semaphore for MaxConcurrent (nil = unlimited)
+}
+
+// NewRateLimiter creates a RateLimiter applying limit to every host.
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	return &RateLimiter{Default: limit}
+}
+
+// SetHostLimit sets a limit for the host overriding Default.
+// must be called before the first request to the host.
+func (limiter *RateLimiter) SetHostLimit(host string, limit RateLimit) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if limiter.Hosts == nil {
+		limiter.Hosts = map[string]RateLimit{}
+	}
+	limiter.Hosts[host] = limit
+}
+
+func (limiter *RateLimiter) host(u *url.URL) *hostLimiter {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if h, ok := limiter.state[u.Host]; ok {
+		return h
+	}
+	limit, ok := limiter.Hosts[u.Host]
+	if !ok {
+		if limit, ok = limiter.Hosts[u.Hostname()]; !ok {
+			limit = limiter.Default
+		}
+	}
+	h := &hostLimiter{limit: limit}
+	if limit.MaxConcurrent > 0 {
+		h.slots = make(chan struct{}, limit.MaxConcurrent)
+	}
+	if limiter.state == nil {
+		limiter.state = map[string]*hostLimiter{}
+	}
+	limiter.state[u.Host] = h
+	return h
+}
+
+// wait blocks until a request to u is allowed, and returns a function to be called
+// when the request finished, and how long it waited.
+func (limiter *RateLimiter) wait(ctx context.Context, u *url.URL) (func(), time.Duration, error) {
+	h := limiter.host(u)
+	start := time.Now()
+
+	release := func() {}
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return release, time.Since(start), ctx.Err()
+		}
+		release = func() { <-h.slots }
+	}
+
+	limiter.mu.Lock()
+	now := time.Now()
+	at := h.next
+	if at.Before(now) {
+		at = now
+	}
+	h.next = at.Add(h.limit.interval())
+	limiter.mu.Unlock()
+
+	if delay := at.Sub(now); delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return func() {}, time.Since(start), ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return release, time.Since(start), nil
+}
+
+// waitRateLimit blocks until session.RateLimiter allows a request to u.
+// It does nothing when RateLimiter is nil or NotUseNetwork is set.
+func (session *Session) waitRateLimit(ctx context.Context, u *url.URL) (func(), error) {
+	if session.RateLimiter == nil || session.NotUseNetwork {
+		return func() {}, nil
+	}
+	release, waited, err := session.RateLimiter.wait(ctx, u)
+	if waited >= time.Millisecond {
+		session.Printf("%s RATE LIMIT: waited %v for %v\n", session.getDebugPrefix(), waited.Round(time.Millisecond), u.Host)
+	}
+	return release, err
+}
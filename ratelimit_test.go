@@ -0,0 +1,187 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimit_interval(t *testing.T) {
+	tests := []struct {
+		limit RateLimit
+		want  time.Duration
+	}{
+		{RateLimit{}, 0},
+		{RateLimit{RequestsPerSecond: 4}, 250 * time.Millisecond},
+		{RateLimit{RequestsPerSecond: 4, MinDelay: time.Second}, time.Second},
+		{RateLimit{RequestsPerSecond: 1, MinDelay: 100 * time.Millisecond}, time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.limit.interval(); got != tt.want {
+			t.Errorf("%+v.interval() = %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiter_wait(t *testing.T) {
+	t.Run("minimum delay per host", func(t *testing.T) {
+		limiter := NewRateLimiter(RateLimit{MinDelay: 30 * time.Millisecond})
+		a, _ := url.Parse("http://a.example.com/")
+		b, _ := url.Parse("http://b.example.com/")
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			release, _, err := limiter.wait(context.Background(), a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			release()
+		}
+		if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+			t.Errorf("3 requests finished in %v, want >= 60ms", elapsed)
+		}
+
+		// another host is not affected
+		_, waited, err := limiter.wait(context.Background(), b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if waited >= 30*time.Millisecond {
+			t.Errorf("other host waited %v", waited)
+		}
+	})
+
+	t.Run("host override", func(t *testing.T) {
+		limiter := NewRateLimiter(RateLimit{MinDelay: time.Hour})
+		limiter.SetHostLimit("fast.example.com", RateLimit{})
+		u, _ := url.Parse("https://fast.example.com/path")
+		for i := 0; i < 3; i++ {
+			if _, waited, err := limiter.wait(context.Background(), u); err != nil || waited >= 10*time.Millisecond {
+				t.Fatalf("waited %v, err %v", waited, err)
+			}
+		}
+	})
+
+	t.Run("max concurrent", func(t *testing.T) {
+		limiter := NewRateLimiter(RateLimit{MaxConcurrent: 2})
+		u, _ := url.Parse("http://example.com/")
+
+		var running, maxRunning int32
+		var wg sync.WaitGroup
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, _, err := limiter.wait(context.Background(), u)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer release()
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+			}()
+		}
+		wg.Wait()
+		if maxRunning > 2 {
+			t.Errorf("max concurrent = %v, want <= 2", maxRunning)
+		}
+	})
+
+	t.Run("canceled while waiting", func(t *testing.T) {
+		limiter := NewRateLimiter(RateLimit{MinDelay: time.Hour})
+		u, _ := url.Parse("http://example.com/")
+		release, _, _ := limiter.wait(context.Background(), u)
+		release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, _, err := limiter.wait(ctx, u); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected DeadlineExceeded, got %v", err)
+		}
+	})
+}
+
+func TestSession_RateLimiter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	if err := os.Mkdir(path.Join(dir, "ratelimit"), 0744); err != nil {
+		t.Fatal(err)
+	}
+	logger := &BufferedLogger{}
+	session := NewSession("ratelimit", logger)
+	session.FilePrefix = dir + "/"
+	session.SaveToFile = true
+	session.RateLimiter = NewRateLimiter(RateLimit{MinDelay: 40 * time.Millisecond})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := session.Get(ts.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("record: 3 requests finished in %v, want >= 80ms", elapsed)
+	}
+
+	// replay is not throttled
+	session.NotUseNetwork = true
+	session.invokeCount = 0
+	session.RateLimiter = NewRateLimiter(RateLimit{MinDelay: time.Hour})
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := session.Get(ts.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("replay was throttled: %v", elapsed)
+	}
+}
+
+func TestSession_RateLimiterRetry(t *testing.T) {
+	var hits []time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits = append(hits, time.Now())
+		if len(hits) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer ts.Close()
+
+	session := NewSession("ratelimit_retry", &BufferedLogger{})
+	session.RateLimiter = NewRateLimiter(RateLimit{MinDelay: 50 * time.Millisecond})
+	session.RetryPolicy = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	if _, err := session.Get(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("server hit %v times, want 2", len(hits))
+	}
+	if interval := hits[1].Sub(hits[0]); interval < 45*time.Millisecond {
+		t.Errorf("retry was sent %v after the first attempt, want >= 50ms", interval)
+	}
+}
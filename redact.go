@@ -0,0 +1,196 @@
+package scraper
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RedactedValue replaces secrets in logs and recordings.
+const RedactedValue = "[REDACTED]"
+
+// Redactor masks secrets before they are logged or saved to the session directory.
+// Names are compared case-insensitively. A nil *Redactor masks nothing.
+type Redactor struct {
+	FormFields []string // form field and query parameter names (e.g. "password")
+	Headers    []string // header names (e.g. "Authorization")
+	Cookies    []string // cookie names in Cookie and Set-Cookie headers (e.g. "JSESSIONID")
+	// Patterns are masked in logs, bodies, URLs and headers.
+	// if a pattern has capture groups, only the groups are masked (e.g. `account=(\d+)`).
+	Patterns []*regexp.Regexp
+}
+
+func containsFold(names []string, name string) bool {
+	return slices.ContainsFunc(names, func(s string) bool { return strings.EqualFold(s, name) })
+}
+
+// hasFormField reports whether values contain one of FormFields.
+func (redactor *Redactor) hasFormField(values url.Values) bool {
+	for name := range values {
+		if containsFold(redactor.FormFields, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact masks Patterns in s.
+func (redactor *Redactor) Redact(s string) string {
+	if redactor == nil {
+		return s
+	}
+	return string(redactor.redactBytes([]byte(s)))
+}
+
+func (redactor *Redactor) redactBytes(b []byte) []byte {
+	if redactor == nil {
+		return b
+	}
+	for _, re := range redactor.Patterns {
+		matches := re.FindAllSubmatchIndex(b, -1)
+		if matches == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		last := 0
+		for _, m := range matches {
+			spans := [][2]int{{m[0], m[1]}}
+			if len(m) > 2 {
+				spans = spans[:0]
+				for i := 2; i+1 < len(m); i += 2 {
+					if m[i] >= 0 {
+						spans = append(spans, [2]int{m[i], m[i+1]})
+					}
+				}
+			}
+			for _, span := range spans {
+				if span[0] < last {
+					continue
+				}
+				buf.Write(b[last:span[0]])
+				buf.WriteString(RedactedValue)
+				last = span[1]
+			}
+		}
+		buf.Write(b[last:])
+		b = buf.Bytes()
+	}
+	return b
+}
+
+// formValue masks value of the form field name.
+func (redactor *Redactor) formValue(name string, value string) string {
+	if redactor == nil {
+		return value
+	}
+	if containsFold(redactor.FormFields, name) {
+		return RedactedValue
+	}
+	return redactor.Redact(value)
+}
+
+// values masks FormFields in urlencoded values.
+func (redactor *Redactor) values(values url.Values) url.Values {
+	masked := url.Values{}
+	for name, list := range values {
+		for _, v := range list {
+			masked.Add(name, redactor.formValue(name, v))
+		}
+	}
+	return masked
+}
+
+// url masks FormFields in the query and Patterns of rawURL.
+func (redactor *Redactor) url(rawURL string) string {
+	if redactor == nil {
+		return rawURL
+	}
+	if u, err := url.Parse(rawURL); err == nil && u.RawQuery != "" {
+		query := u.Query()
+		if redactor.hasFormField(query) {
+			u.RawQuery = redactor.values(query).Encode()
+			rawURL = u.String()
+		}
+	}
+	return redactor.Redact(rawURL)
+}
+
+// cookies masks values of Cookies in a Cookie or Set-Cookie header value.
+func (redactor *Redactor) cookies(value string, setCookie bool) string {
+	parts := strings.Split(value, ";")
+	for i, part := range parts {
+		if setCookie && i > 0 {
+			break // attributes
+		}
+		name, _, ok := strings.Cut(part, "=")
+		if ok && containsFold(redactor.Cookies, strings.TrimSpace(name)) {
+			parts[i] = name + "=" + RedactedValue
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// header returns a copy of header with secrets masked.
+func (redactor *Redactor) header(header http.Header) http.Header {
+	if redactor == nil || header == nil {
+		return header
+	}
+	masked := make(http.Header, len(header))
+	for name, values := range header {
+		list := make([]string, len(values))
+		for i, v := range values {
+			switch {
+			case containsFold(redactor.Headers, name):
+				v = RedactedValue
+			case strings.EqualFold(name, "Cookie"):
+				v = redactor.cookies(v, false)
+			case strings.EqualFold(name, "Set-Cookie"):
+				v = redactor.cookies(v, true)
+			case strings.EqualFold(name, "Referer") || strings.EqualFold(name, "Location"):
+				v = redactor.url(v)
+			}
+			list[i] = redactor.Redact(v)
+		}
+		masked[name] = list
+	}
+	return masked
+}
+
+// requestBody masks a request body of contentType.
+// urlencoded bodies are masked field by field, others by Patterns.
+func (redactor *Redactor) requestBody(contentType string, body []byte) []byte {
+	if redactor == nil || len(body) == 0 {
+		return body
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/x-www-form-urlencoded" {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			if redactor.hasFormField(values) {
+				return redactor.redactBytes([]byte(redactor.values(values).Encode()))
+			}
+		}
+	}
+	return redactor.redactBytes(body)
+}
+
+// metadata returns a copy of metadata with secrets masked.
+func (redactor *Redactor) metadata(metadata PageMetadata) PageMetadata {
+	if redactor == nil {
+		return metadata
+	}
+	metadata.URL = redactor.url(metadata.URL)
+	metadata.Title = redactor.Redact(metadata.Title)
+	metadata.Header = redactor.header(metadata.Header)
+	metadata.RequestHeader = redactor.header(metadata.RequestHeader)
+	if metadata.Redirects != nil {
+		redirects := make([]RedirectHop, len(metadata.Redirects))
+		for i, hop := range metadata.Redirects {
+			redirects[i] = RedirectHop{URL: redactor.url(hop.URL), StatusCode: hop.StatusCode, Header: redactor.header(hop.Header)}
+		}
+		metadata.Redirects = redirects
+	}
+	return metadata
+}
@@ -0,0 +1,176 @@
+package scraper
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedactor_Redact(t *testing.T) {
+	redactor := &Redactor{Patterns: []*regexp.Regexp{
+		regexp.MustCompile(`account=(\d+)`),
+		regexp.MustCompile(`\d{4}-\d{4}-\d{4}-\d{4}`),
+	}}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"no secret", "no secret"},
+		{"account=1234567 ok", "account=[REDACTED] ok"},
+		{"card 1111-2222-3333-4444.", "card [REDACTED]."},
+		{"account=1&account=2", "account=[REDACTED]&account=[REDACTED]"},
+	}
+	for _, tt := range tests {
+		if got := redactor.Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	var nilRedactor *Redactor
+	if got := nilRedactor.Redact("account=1"); got != "account=1" {
+		t.Errorf("nil Redactor changed the value: %q", got)
+	}
+}
+
+func TestRedactor_header(t *testing.T) {
+	redactor := &Redactor{
+		FormFields: []string{"token"},
+		Headers:    []string{"authorization"},
+		Cookies:    []string{"SID"},
+	}
+	header := http.Header{
+		"Authorization": {"Bearer secret"},
+		"Cookie":        {"lang=ja; sid=abc"},
+		"Set-Cookie":    {"SID=xyz; Path=/; HttpOnly", "lang=en"},
+		"Location":      {"https://example.com/next?token=t1&page=2"},
+		"Accept":        {"text/html"},
+	}
+	want := http.Header{
+		"Authorization": {RedactedValue},
+		"Cookie":        {"lang=ja; sid=" + RedactedValue},
+		"Set-Cookie":    {"SID=" + RedactedValue + "; Path=/; HttpOnly", "lang=en"},
+		"Location":      {"https://example.com/next?page=2&token=%5BREDACTED%5D"},
+		"Accept":        {"text/html"},
+	}
+	if diff := cmp.Diff(want, redactor.header(header)); diff != "" {
+		t.Errorf("header mismatch (-want +got):\n%s", diff)
+	}
+	if header.Get("Authorization") != "Bearer secret" {
+		t.Error("original header was modified")
+	}
+}
+
+func TestSession_Redactor(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "SID", Value: "session-secret"})
+		fmt.Fprintf(w, "<html><body>welcome %v, account=9876543</body></html>", r.FormValue("user"))
+	}))
+	defer ts.Close()
+
+	redactor := &Redactor{
+		FormFields: []string{"password"},
+		Cookies:    []string{"SID"},
+		Patterns:   []*regexp.Regexp{regexp.MustCompile(`account=(\d+)`)},
+	}
+	login := func(session *Session, password string) (*Response, error) {
+		form := &Form{url: mustParseURL(t, ts.URL), baseUrl: mustParseURL(t, ts.URL), Action: "/login", Method: "post",
+			Elements: map[string]*FormElement{
+				"user":     {Type: "text", Name: "user", Value: &AvailableValue{Value: "alice"}},
+				"password": {Type: "password", Name: "password", Value: &AvailableValue{Value: password}},
+			},
+			Logger: session.Log}
+		return session.Submit(form)
+	}
+
+	dir := t.TempDir()
+	logger := &BufferedLogger{}
+	record := NewSession("redact", logger)
+	record.FilePrefix = dir + "/"
+	record.SaveToFile = true
+	record.ShowFormPosting = true
+	record.ShowRequestHeader = true
+	record.ShowResponseHeader = true
+	record.Redactor = redactor
+
+	resp, err := login(record, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(resp.RawBody), "account=9876543") {
+		t.Errorf("the response itself must not be masked: %q", resp.RawBody)
+	}
+
+	secrets := []string{"hunter2", "session-secret", "9876543"}
+	for _, secret := range secrets {
+		if strings.Contains(logger.String(), secret) {
+			t.Errorf("log contains %q:\n%v", secret, logger.String())
+		}
+	}
+	files, _ := filepath.Glob(path.Join(dir, "redact", "*"))
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(string(b), secret) {
+				t.Errorf("%v contains %q: %s", f, secret, b)
+			}
+		}
+	}
+
+	// replay from the redacted recording with another password
+	replay := NewSession("redact", &BufferedLogger{})
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	replay.ReplayMode = ReplayByRequest
+	replay.Redactor = redactor
+	resp, err = login(replay, "dummy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(resp.RawBody), "welcome alice, account="+RedactedValue) {
+		t.Errorf("replayed body = %q", resp.RawBody)
+	}
+}
+
+func TestSession_RedactorRetry(t *testing.T) {
+	var count int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count++; count == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer ts.Close()
+
+	logger := &BufferedLogger{}
+	session := NewSession("redact_retry", logger)
+	session.RetryPolicy = &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	session.Redactor = &Redactor{
+		FormFields: []string{"password"},
+		Patterns:   []*regexp.Regexp{regexp.MustCompile(`account=(\d+)`)},
+	}
+	if _, err := session.Get(ts.URL + "/?password=hunter2&account=9876543"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logger.String(), "RETRY") {
+		t.Fatalf("no RETRY log:\n%v", logger.String())
+	}
+	for _, secret := range []string{"hunter2", "9876543"} {
+		if strings.Contains(logger.String(), secret) {
+			t.Errorf("log contains %q:\n%v", secret, logger.String())
+		}
+	}
+}
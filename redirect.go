@@ -0,0 +1,65 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+)
+
+// defaultMaxRedirects is the number of redirects followed by default, same as http.Client.
+const defaultMaxRedirects = 10
+
+// redirectPolicy is the redirect policy of a request.
+type redirectPolicy struct {
+	stop bool
+	max  int
+}
+
+type redirectPolicyKey struct{}
+
+// redirectPolicy returns the redirect policy of Session overridden by opt.
+func (session *Session) redirectPolicy(opt RequestOption) redirectPolicy {
+	policy := redirectPolicy{
+		stop: session.StopOnRedirect || opt.StopOnRedirect,
+		max:  session.MaxRedirects,
+	}
+	if opt.MaxRedirects != 0 {
+		policy.max = opt.MaxRedirects
+	}
+	if policy.max <= 0 {
+		policy.max = defaultMaxRedirects
+	}
+	return policy
+}
+
+func withRedirectPolicy(ctx context.Context, policy redirectPolicy) context.Context {
+	return context.WithValue(ctx, redirectPolicyKey{}, policy)
+}
+
+// checkRedirect is CheckRedirect of session.client.
+func (session *Session) checkRedirect(req *http.Request, via []*http.Request) error {
+	policy, ok := req.Context().Value(redirectPolicyKey{}).(redirectPolicy)
+	if !ok {
+		policy = redirectPolicy{max: defaultMaxRedirects}
+	}
+	if policy.stop {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > policy.max {
+		return TooManyRedirectsError{Max: policy.max}
+	}
+	if session.checkRedirectFunc != nil {
+		return session.checkRedirectFunc(req, via)
+	}
+	return nil
+}
+
+// printRedirects prints redirect hops with their Set-Cookie headers.
+func (session *Session) printRedirects(redirects []RedirectHop) {
+	for i, hop := range redirects {
+		session.Printf("Redirect %v: %v %v -> %v\n", i+1, hop.StatusCode,
+			session.Redactor.url(hop.URL), session.Redactor.url(hop.Location()))
+		for _, cookie := range session.Redactor.header(hop.Header)["Set-Cookie"] {
+			session.Printf("  Set-Cookie: %v\n", cookie)
+		}
+	}
+}
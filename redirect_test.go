@@ -0,0 +1,105 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newRedirectServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "step", Value: "1"})
+			http.Redirect(w, r, "/sso", http.StatusFound)
+		case "/sso":
+			http.SetCookie(w, &http.Cookie{Name: "token", Value: "abc"})
+			http.Redirect(w, r, "/home", http.StatusSeeOther)
+		default:
+			fmt.Fprintf(w, "<html>%v</html>", r.Header.Get("Cookie"))
+		}
+	}))
+}
+
+func TestSession_Redirects(t *testing.T) {
+	ts := newRedirectServer()
+	defer ts.Close()
+
+	logger := &BufferedLogger{}
+	session := NewSession("redirects", logger)
+	session.FilePrefix = t.TempDir() + "/"
+	session.ShowResponseHeader = true
+	session.Redactor = &Redactor{Cookies: []string{"token"}}
+
+	resp, err := session.Get(ts.URL + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Redirects) != 2 {
+		t.Fatalf("redirects = %+v", resp.Redirects)
+	}
+	if cookies := resp.Redirects[1].Cookies(); len(cookies) != 1 || cookies[0].Name != "token" || cookies[0].Value != "abc" {
+		t.Errorf("cookies of hop 2 = %v", cookies)
+	}
+	log := logger.String()
+	for _, want := range []string{
+		"Redirect 1: 302 " + ts.URL + "/login -> /sso\n  Set-Cookie: step=1\n",
+		"Redirect 2: 303 " + ts.URL + "/sso -> /home\n  Set-Cookie: token=[REDACTED]\n",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log does not contain %q:\n%v", want, log)
+		}
+	}
+
+	resp, err = session.GetOpt(context.Background(), ts.URL+"/login", RequestOption{StopOnRedirect: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusFound || resp.Location() != "/sso" || len(resp.Redirects) != 0 {
+		t.Errorf("stopped response = %v %v %v", resp.StatusCode, resp.Location(), resp.Redirects)
+	}
+
+	_, err = session.GetOpt(context.Background(), ts.URL+"/login", RequestOption{MaxRedirects: 1})
+	var tooMany TooManyRedirectsError
+	if !errors.As(err, &tooMany) || tooMany.Max != 1 {
+		t.Errorf("err = %v", err)
+	}
+
+	session.MaxRedirects = 1
+	if _, err := session.Get(ts.URL + "/login"); !errors.As(err, &tooMany) {
+		t.Errorf("Session.MaxRedirects: err = %v", err)
+	}
+	if _, err := session.GetOpt(context.Background(), ts.URL+"/login", RequestOption{MaxRedirects: 2}); err != nil {
+		t.Errorf("RequestOption.MaxRedirects should override: %v", err)
+	}
+}
+
+func TestSession_StopOnRedirectReplay(t *testing.T) {
+	ts := newRedirectServer()
+	defer ts.Close()
+
+	dir := t.TempDir()
+	record := NewSession("stop_on_redirect", &BufferedLogger{})
+	record.FilePrefix = dir + "/"
+	record.SaveToFile = true
+	record.StopOnRedirect = true
+	if _, err := record.Get(ts.URL + "/login"); err != nil {
+		t.Fatal(err)
+	}
+
+	replay := NewSession("stop_on_redirect", &BufferedLogger{})
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	replay.StopOnRedirect = true
+	resp, err := replay.Get(ts.URL + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusFound || resp.Location() != "/sso" {
+		t.Errorf("replayed = %v %v", resp.StatusCode, resp.Location())
+	}
+}
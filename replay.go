@@ -0,0 +1,241 @@
+package scraper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ReplayMode selects how recorded files are matched with requests when NotUseNetwork is set.
+type ReplayMode int
+
+const (
+	// ReplaySequential loads N.html for the Nth request.
+	ReplaySequential ReplayMode = iota
+	// ReplayByRequest loads the recording of the same method, normalized URL and body hash.
+	// Session directories recorded without request information fall back to ReplaySequential.
+	ReplayByRequest
+)
+
+// RecordedRequest identifies the request which produced a saved page.
+type RecordedRequest struct {
+	Method   string         `json:"method"`
+	URL      string         `json:"url"`                 // requested URL before redirects
+	BodyHash string         `json:"body_hash,omitempty"` // hex encoded SHA-256 of the request body
+	Files    []RecordedFile `json:"files,omitempty"`     // files uploaded by a multipart/form-data body
+	// Body is the request body masked by Redactor (multipart/form-data bodies without file contents).
+	Body         string `json:"body,omitempty"`
+	BodyEncoding string `json:"body_encoding,omitempty"` // "base64" if Body is not UTF-8
+}
+
+func (r RecordedRequest) String() string {
+	if r.BodyHash == "" {
+		return fmt.Sprintf("%v %v", r.Method, r.URL)
+	}
+	return fmt.Sprintf("%v %v (body %.12s)", r.Method, r.URL, r.BodyHash)
+}
+
+// key returns the matching key of the request ignoring query parameters in ignoreParams.
+func (r RecordedRequest) key(ignoreParams []string) string {
+	return strings.Join([]string{strings.ToUpper(r.Method), normalizeURL(r.URL, ignoreParams), r.BodyHash}, " ")
+}
+
+// newRecordedRequest returns RecordedRequest of req with secrets masked by redactor.
+// the body of req is kept readable.
+func newRecordedRequest(req *http.Request, redactor *Redactor) (*RecordedRequest, error) {
+	recorded := &RecordedRequest{
+		Method: req.Method,
+		URL:    redactor.url(req.URL.String()),
+	}
+	if recorded.Method == "" {
+		recorded.Method = http.MethodGet
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return recorded, nil
+	}
+
+	var body []byte
+	var err error
+	if req.GetBody != nil {
+		var rc io.ReadCloser
+		if rc, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+		body, err = io.ReadAll(rc)
+		_ = rc.Close()
+	} else {
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	body, recorded.Files = canonicalRequestBody(req.Header.Get("Content-Type"), body, redactor)
+	if len(body) > 0 {
+		recorded.BodyHash = hashBody(body)
+		if utf8.Valid(body) {
+			recorded.Body = string(body)
+		} else {
+			recorded.Body = base64.StdEncoding.EncodeToString(body)
+			recorded.BodyEncoding = "base64"
+		}
+	}
+	return recorded, nil
+}
+
+// canonicalRequestBody returns body masked by redactor for recording and replay matching.
+// a multipart/form-data body is converted to urlencoded fields without the contents of uploaded files,
+// which are returned instead. urlencoded fields are sorted by name as Submit sends them,
+// since browsers send them in the document order.
+func canonicalRequestBody(contentType string, body []byte, redactor *Redactor) ([]byte, []RecordedFile) {
+	var files []RecordedFile
+	if boundary, ok := isMultipart(contentType); ok {
+		if fields, uploaded, err := multipartFields(boundary, body); err == nil {
+			body, files = []byte(fields.Encode()), uploaded
+			contentType = EnctypeURLEncoded
+		}
+	} else if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == EnctypeURLEncoded && len(body) > 0 {
+		if fields, err := url.ParseQuery(string(body)); err == nil {
+			body = []byte(fields.Encode())
+		}
+	}
+	return redactor.requestBody(contentType, body), files
+}
+
+// hashRequestBody returns the hash of canonicalRequestBody and uploaded files.
+func hashRequestBody(contentType string, body []byte, redactor *Redactor) (string, []RecordedFile) {
+	body, files := canonicalRequestBody(contentType, body, redactor)
+	if len(body) == 0 {
+		return "", files
+	}
+	return hashBody(body), files
+}
+
+func hashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeURL normalizes rawURL for replay matching:
+// lower-cased scheme and host, default port and fragment removed,
+// query parameters sorted and those in ignoreParams removed.
+func normalizeURL(rawURL string, ignoreParams []string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	u.Host = host
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	query := u.Query()
+	for _, name := range ignoreParams {
+		query.Del(name)
+	}
+	u.RawQuery = query.Encode() // sorted by key
+	return u.String()
+}
+
+// replayIndex maps request keys to recorded files.
+type replayIndex struct {
+	sequential bool                     // no request information recorded
+	files      map[string][]int         // key -> record numbers not replayed yet
+	recorded   map[int]*RecordedRequest // record number -> request
+}
+
+var recordFilenameRegexp = regexp.MustCompile(`^(\d+)\.html$`)
+
+// recordMetadataRegexp matches metadata of recordings, including downloads without N.html.
+var recordMetadataRegexp = regexp.MustCompile(`^(\d+)\.html\.meta$`)
+
+func loadReplayIndex(dirname string, ignoreParams []string) (*replayIndex, error) {
+	entries, err := os.ReadDir(dirname)
+	if err != nil {
+		return nil, err
+	}
+	index := &replayIndex{
+		files:    map[string][]int{},
+		recorded: map[int]*RecordedRequest{},
+	}
+	var numbers []int
+	for _, entry := range entries {
+		match := recordMetadataRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(match[1])
+		metadata, err := loadPageMetadata(path.Join(dirname, strings.TrimSuffix(entry.Name(), MetadataFileExtension)))
+		if err != nil || metadata.Request == nil {
+			continue
+		}
+		index.recorded[n] = metadata.Request
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	for _, n := range numbers {
+		key := index.recorded[n].key(ignoreParams)
+		index.files[key] = append(index.files[key], n)
+	}
+	index.sequential = len(numbers) == 0
+	return index, nil
+}
+
+// replayFilename returns the recorded file for request in ReplayByRequest mode.
+func (session *Session) replayFilename(request *RecordedRequest) (string, error) {
+	if session.replayIndex == nil {
+		index, err := loadReplayIndex(session.getDirectory(), session.ReplayIgnoreParams)
+		if err != nil {
+			return "", RetryAndRecordError{session.getDirectory()}
+		}
+		if index.sequential {
+			session.Printf("%s REPLAY: no request information in %v, replaying sequentially\n", session.getDebugPrefix(), session.getDirectory())
+		}
+		session.replayIndex = index
+	}
+	index := session.replayIndex
+	if index.sequential {
+		return session.getHtmlFilename(), nil
+	}
+
+	key := request.key(session.ReplayIgnoreParams)
+	numbers := index.files[key]
+	if len(numbers) == 0 {
+		return "", ReplayMismatchError{
+			Sequence: session.invokeCount,
+			Request:  *request,
+			Recorded: index.recorded[session.invokeCount],
+		}
+	}
+	n := numbers[0]
+	index.files[key] = slices.Delete(numbers, 0, 1)
+	if n != session.invokeCount {
+		session.Printf("%s REPLAY: request #%v %v matched record #%v\n", session.getDebugPrefix(), session.invokeCount, request, n)
+	}
+	return path.Join(session.getDirectory(), fmt.Sprintf("%v.html", n)), nil
+}
@@ -0,0 +1,158 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func Test_normalizeURL(t *testing.T) {
+	tests := []struct {
+		url    string
+		ignore []string
+		want   string
+	}{
+		{"HTTP://Example.COM", nil, "http://example.com/"},
+		{"http://example.com:80/a", nil, "http://example.com/a"},
+		{"https://example.com:443/a", nil, "https://example.com/a"},
+		{"https://example.com:8443/a", nil, "https://example.com:8443/a"},
+		{"http://example.com/a?b=2&a=1#frag", nil, "http://example.com/a?a=1&b=2"},
+		{"http://example.com/a?_=123&a=1&nonce=x", []string{"_", "nonce"}, "http://example.com/a?a=1"},
+	}
+	for _, tt := range tests {
+		if got := normalizeURL(tt.url, tt.ignore); got != tt.want {
+			t.Errorf("normalizeURL(%q, %v) = %q, want %q", tt.url, tt.ignore, got, tt.want)
+		}
+	}
+}
+
+func TestSession_ReplayByRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		fmt.Fprintf(w, "<html><body>%v %v %v</body></html>", r.Method, r.URL.Path, r.PostForm.Get("q"))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	record := NewSession("replay_by_request", &BufferedLogger{})
+	record.FilePrefix = dir + "/"
+	record.SaveToFile = true
+
+	get := func(session *Session, p string) (string, error) {
+		resp, err := session.Get(ts.URL + p)
+		if err != nil {
+			return "", err
+		}
+		return string(resp.RawBody), nil
+	}
+	post := func(session *Session, q string) (string, error) {
+		form := &Form{url: mustParseURL(t, ts.URL), baseUrl: mustParseURL(t, ts.URL), Action: "/search", Method: "post",
+			Elements: map[string]*FormElement{"q": {Type: "text", Name: "q", Value: &AvailableValue{Value: q}}},
+			Logger:   &BufferedLogger{}}
+		resp, err := session.Submit(form)
+		if err != nil {
+			return "", err
+		}
+		return string(resp.RawBody), nil
+	}
+
+	for _, p := range []string{"/a?_=1", "/b"} {
+		if _, err := get(record, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, q := range []string{"x", "y"} {
+		if _, err := post(record, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logger := &BufferedLogger{}
+	replay := NewSession("replay_by_request", logger)
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	replay.ReplayMode = ReplayByRequest
+	replay.ReplayIgnoreParams = []string{"_"}
+
+	// an extra request which is not in the recording
+	_, err := get(replay, "/inserted")
+	var mismatch ReplayMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected ReplayMismatchError, got %v", err)
+	}
+	if mismatch.Sequence != 1 || mismatch.Recorded == nil || !strings.HasSuffix(mismatch.Recorded.URL, "/a?_=1") {
+		t.Errorf("unexpected mismatch report: %v", mismatch)
+	}
+
+	// following requests still match, in a different order and with another timestamp
+	want := map[string]string{
+		"post y": "POST /search y",
+		"get /b": "GET /b ",
+		"get /a": "GET /a ",
+		"post x": "POST /search x",
+	}
+	for _, step := range []string{"post y", "get /b", "get /a", "post x"} {
+		var body string
+		switch step {
+		case "post y":
+			body, err = post(replay, "y")
+		case "post x":
+			body, err = post(replay, "x")
+		case "get /a":
+			body, err = get(replay, "/a?_=999")
+		default:
+			body, err = get(replay, "/b")
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", step, err)
+		}
+		if !strings.Contains(body, want[step]) {
+			t.Errorf("%v: body = %q, want %q", step, body, want[step])
+		}
+	}
+	if !strings.Contains(logger.String(), "matched record #") {
+		t.Errorf("expected out-of-order match to be logged:\n%v", logger.String())
+	}
+
+	// recordings are consumed
+	if _, err := get(replay, "/b"); !errors.As(err, &mismatch) {
+		t.Errorf("expected ReplayMismatchError for the second /b, got %v", err)
+	}
+	replay.Rewind()
+	if _, err := get(replay, "/b"); err != nil {
+		t.Errorf("after Rewind: %v", err)
+	}
+}
+
+func TestSession_ReplayByRequest_FallbackSequential(t *testing.T) {
+	dir := t.TempDir()
+	sessionDir := path.Join(dir, "legacy")
+	if err := os.Mkdir(sessionDir, 0744); err != nil {
+		t.Fatal(err)
+	}
+	filename := path.Join(sessionDir, "1.html")
+	if err := os.WriteFile(filename, []byte("<html><body>legacy</body></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := savePageMetadata(filename, PageMetadata{URL: "http://example.com/", ContentType: "text/html"}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := NewSession("legacy", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.NotUseNetwork = true
+	session.ReplayMode = ReplayByRequest
+
+	resp, err := session.Get("http://other.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(resp.RawBody), "legacy") {
+		t.Errorf("body = %q", resp.RawBody)
+	}
+}
@@ -0,0 +1,74 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Send sends a request of method to rawURL with body of contentType through invoke,
+// so that it is logged, recorded and replayed like Get.
+// body may be nil for a request without body.
+func (session *Session) Send(ctx context.Context, method string, rawURL string, contentType string, body []byte, opt RequestOption) (*Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	return session.invokeOpt(req, opt)
+}
+
+// SendJSON sends v encoded as JSON with method to rawURL.
+// Accept is application/json unless opt.Header specifies it.
+func (session *Session) SendJSON(ctx context.Context, method string, rawURL string, v interface{}, opt RequestOption) (*Response, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Header.Get("Accept") == "" {
+		opt.Header = opt.Header.Clone()
+		if opt.Header == nil {
+			opt.Header = http.Header{}
+		}
+		opt.Header.Set("Accept", "application/json")
+	}
+	return session.Send(ctx, method, rawURL, "application/json", body, opt)
+}
+
+// PostJSON sends v encoded as JSON with POST to rawURL.
+func (session *Session) PostJSON(ctx context.Context, rawURL string, v interface{}, opt RequestOption) (*Response, error) {
+	return session.SendJSON(ctx, http.MethodPost, rawURL, v, opt)
+}
+
+// PutJSON sends v encoded as JSON with PUT to rawURL.
+func (session *Session) PutJSON(ctx context.Context, rawURL string, v interface{}, opt RequestOption) (*Response, error) {
+	return session.SendJSON(ctx, http.MethodPut, rawURL, v, opt)
+}
+
+// PatchJSON sends v encoded as JSON with PATCH to rawURL.
+func (session *Session) PatchJSON(ctx context.Context, rawURL string, v interface{}, opt RequestOption) (*Response, error) {
+	return session.SendJSON(ctx, http.MethodPatch, rawURL, v, opt)
+}
+
+// PostForm sends values urlencoded with POST to rawURL.
+func (session *Session) PostForm(ctx context.Context, rawURL string, values url.Values, opt RequestOption) (*Response, error) {
+	return session.Send(ctx, http.MethodPost, rawURL, EnctypeURLEncoded, []byte(values.Encode()), opt)
+}
+
+// Delete sends DELETE to rawURL.
+func (session *Session) Delete(ctx context.Context, rawURL string, opt RequestOption) (*Response, error) {
+	return session.Send(ctx, http.MethodDelete, rawURL, "", nil, opt)
+}
@@ -0,0 +1,151 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/text/encoding/japanese"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"regexp"
+	"testing"
+)
+
+type echoResult struct {
+	Method      string `json:"method"`
+	ContentType string `json:"content_type"`
+	Accept      string `json:"accept"`
+	APIKey      string `json:"api_key"`
+	Body        string `json:"body"`
+}
+
+func newEchoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(echoResult{
+			Method:      r.Method,
+			ContentType: r.Header.Get("Content-Type"),
+			Accept:      r.Header.Get("Accept"),
+			APIKey:      r.Header.Get("X-Api-Key"),
+			Body:        string(body),
+		})
+	}))
+}
+
+func TestSession_Send(t *testing.T) {
+	ts := newEchoServer(t)
+	defer ts.Close()
+
+	session := NewSession("send", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	ctx := context.Background()
+	payload := map[string]interface{}{"id": 1, "name": "テスト"}
+	opt := RequestOption{Header: http.Header{"X-Api-Key": {"key1"}}}
+
+	tests := []struct {
+		title string
+		send  func() (*Response, error)
+		want  echoResult
+	}{
+		{"PostJSON", func() (*Response, error) { return session.PostJSON(ctx, ts.URL, payload, opt) },
+			echoResult{"POST", "application/json", "application/json", "key1", `{"id":1,"name":"テスト"}`}},
+		{"PutJSON", func() (*Response, error) { return session.PutJSON(ctx, ts.URL, payload, RequestOption{}) },
+			echoResult{"PUT", "application/json", "application/json", "", `{"id":1,"name":"テスト"}`}},
+		{"PatchJSON with Accept", func() (*Response, error) {
+			return session.PatchJSON(ctx, ts.URL, payload, RequestOption{Header: http.Header{"Accept": {"*/*"}}})
+		}, echoResult{"PATCH", "application/json", "*/*", "", `{"id":1,"name":"テスト"}`}},
+		{"PostForm", func() (*Response, error) { return session.PostForm(ctx, ts.URL, url.Values{"a": {"1"}}, opt) },
+			echoResult{"POST", "application/x-www-form-urlencoded", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "key1", "a=1"}},
+		{"Delete", func() (*Response, error) { return session.Delete(ctx, ts.URL, RequestOption{}) },
+			echoResult{"DELETE", "", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "", ""}},
+		{"Send raw", func() (*Response, error) {
+			return session.Send(ctx, "POST", ts.URL, "text/plain", []byte("raw body"), RequestOption{})
+		}, echoResult{"POST", "text/plain", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "", "raw body"}},
+	}
+	for _, tt := range tests {
+		resp, err := tt.send()
+		if err != nil {
+			t.Fatalf("%v: %v", tt.title, err)
+		}
+		var got echoResult
+		if err := resp.JSON(&got); err != nil {
+			t.Fatalf("%v: %v", tt.title, err)
+		}
+		if got != tt.want {
+			t.Errorf("%v: got %+v, want %+v", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestSession_SendRecordAndReplay(t *testing.T) {
+	ts := newEchoServer(t)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	record := NewSession("send_replay", &BufferedLogger{})
+	record.FilePrefix = dir + "/"
+	record.SaveToFile = true
+	record.Redactor = &Redactor{Patterns: []*regexp.Regexp{regexp.MustCompile(`"token":"([^"]*)"`)}}
+	ctx := context.Background()
+	for _, id := range []int{1, 2} {
+		if _, err := record.PostJSON(ctx, ts.URL+"/api", map[string]interface{}{"id": id, "token": "secret"}, RequestOption{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	metadata, err := loadPageMetadata(path.Join(dir, "send_replay", "2.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := metadata.Request.Body; body != `{"id":2,"token":"[REDACTED]"}` {
+		t.Errorf("recorded body = %v", body)
+	}
+
+	replay := NewSession("send_replay", &BufferedLogger{})
+	replay.FilePrefix = dir + "/"
+	replay.NotUseNetwork = true
+	replay.ReplayMode = ReplayByRequest
+	replay.Redactor = record.Redactor
+	for _, id := range []int{2, 1} {
+		resp, err := replay.PostJSON(ctx, ts.URL+"/api", map[string]interface{}{"id": id, "token": "secret"}, RequestOption{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got echoResult
+		if err := resp.JSON(&got); err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf(`{"id":%v,"token":"secret"}`, id); got.Body != want {
+			t.Errorf("replayed body = %v, want %v", got.Body, want)
+		}
+	}
+}
+
+func TestResponse_JSON(t *testing.T) {
+	sjis, err := encode(`{"name":"日本語"}`, japanese.ShiftJIS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		title       string
+		body        []byte
+		contentType string
+	}{
+		{"Shift_JIS", sjis, "application/json; charset=Shift_JIS"},
+		{"UTF-8 with BOM", []byte("\xef\xbb\xbf" + `{"name":"日本語"}`), "application/json"},
+	}
+	for _, tt := range tests {
+		response := &Response{RawBody: tt.body, ContentType: tt.contentType, Logger: &DummyLogger{}}
+		var v struct{ Name string }
+		if err := response.JSON(&v); err != nil {
+			t.Fatalf("%v: %v", tt.title, err)
+		}
+		if v.Name != "日本語" {
+			t.Errorf("%v: Name = %v", tt.title, v.Name)
+		}
+	}
+}
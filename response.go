@@ -3,32 +3,83 @@ package scraper
 import (
 	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/dimchansky/utfbom"
 	"golang.org/x/text/encoding"
-	"golang.org/x/text/encoding/japanese"
 	"golang.org/x/text/transform"
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strings"
 )
 
 // Response holds a raw response and its request information.
 type Response struct {
 	Request     *http.Request
+	StatusCode  int           // HTTP status code (e.g. 200)
+	Header      http.Header   // response headers
+	Redirects   []RedirectHop // redirect responses followed before this response
 	ContentType string
-	RawBody     []byte
-	Encoding    encoding.Encoding
-	Logger      Logger
+	// ContentEncoding is the Content-Encoding of the response (e.g. "gzip"), "" if not encoded.
+	// RawBody is already decoded from it.
+	ContentEncoding string
+	RawBody         []byte
+	CompressedBody  []byte            // the body as received before decoding ContentEncoding (nil if not encoded)
+	Filename        string            // file the body was saved to by Session.Download (RawBody is nil)
+	Encoding        encoding.Encoding // encoding of the body (nil if UTF-8 or not determined yet)
+	EncodingSource  EncodingSource    // how Encoding was determined by DetectEncoding
+	Logger          Logger
+}
+
+// RedirectHop holds a redirect response followed while requesting a page.
+type RedirectHop struct {
+	URL        string      `json:"url"` // requested URL which responded the redirect
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"` // including Location and Set-Cookie
+}
+
+// Location returns the redirect target of the hop.
+func (hop RedirectHop) Location() string {
+	return hop.Header.Get("Location")
+}
+
+// Cookies parses Set-Cookie headers of the hop.
+func (hop RedirectHop) Cookies() []*http.Cookie {
+	return (&http.Response{Header: hop.Header}).Cookies()
+}
+
+// Location returns the Location header of the response, the redirect target if StopOnRedirect stopped it.
+func (response *Response) Location() string {
+	return response.Header.Get("Location")
+}
+
+// redirectChain returns redirect responses which led to response, in order.
+func redirectChain(response *http.Response) []RedirectHop {
+	var hops []RedirectHop
+	for req := response.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		r := req.Response
+		hops = append(hops, RedirectHop{
+			URL:        r.Request.URL.String(),
+			StatusCode: r.StatusCode,
+			Header:     r.Header,
+		})
+	}
+	slices.Reverse(hops)
+	return hops
+}
+
+// bodyEncoding returns the encoding of the body determined by DetectEncoding.
+// returns nil for UTF-8 or unknown charsets.
+func (response *Response) bodyEncoding() encoding.Encoding {
+	e, _ := response.DetectEncoding()
+	return e
 }
 
 // Body returns response body converted from response.Encoding(if not nil).
 func (response *Response) Body() ([]byte, error) {
-	e := response.Encoding
-	if e == nil {
-		e = getEncodingFromCharset(charsetFromContentType(response.ContentType))
-	}
+	e := response.bodyEncoding()
 	if e == nil {
 		return response.RawBody, nil
 	}
@@ -37,6 +88,15 @@ func (response *Response) Body() ([]byte, error) {
 	return b, err
 }
 
+// JSON decodes the response body converted from response.Encoding(if not nil) as JSON into v.
+func (response *Response) JSON(v interface{}) error {
+	body, err := response.Body()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), v)
+}
+
 // CsvReader returns csv.Reader of the response.
 // it assumes the response is a CSV.
 func (response *Response) CsvReader() *csv.Reader {
@@ -51,18 +111,24 @@ type PageOption struct {
 	BodyFilter func(resp *Response, body []byte) ([]byte, error)
 }
 
-// PageOpt parses raw response to DOM tree and returns a Page object.
-func (response *Response) PageOpt(option PageOption) (*Page, error) {
-	if response.Encoding == nil {
-		doc, err := goquery.NewDocumentFromReader(bytes.NewBuffer(response.RawBody))
-		if err != nil {
-			return nil, err
-		}
-		e := getEncodingFromCharset(getCharsetFromHead(doc))
-		if e != nil {
-			response.Encoding = e
+// DetectEncoding determines response.Encoding and EncodingSource from the BOM, <meta> charset,
+// charset of ContentType or the bytes of the body in this order, and returns them.
+// Encoding set beforehand (e.g. by Session.Encoding) is kept as EncodingSourceForced.
+// the result is kept until EncodingSource is reset to EncodingSourceUnknown.
+func (response *Response) DetectEncoding() (encoding.Encoding, EncodingSource) {
+	if response.EncodingSource == EncodingSourceUnknown {
+		if response.Encoding != nil {
+			response.EncodingSource = EncodingSourceForced
+		} else {
+			response.Encoding, response.EncodingSource = sniffEncoding(response.RawBody, response.ContentType)
 		}
 	}
+	return response.Encoding, response.EncodingSource
+}
+
+// PageOpt parses raw response to DOM tree and returns a Page object.
+func (response *Response) PageOpt(option PageOption) (*Page, error) {
+	response.DetectEncoding()
 
 	body, err := response.Body()
 	if err != nil {
@@ -96,7 +162,7 @@ func (response *Response) PageOpt(option PageOption) (*Page, error) {
 	// title
 	response.Logger.Printf("* %v\n", doc.Find("title").Text())
 
-	return &Page{doc, baseUrl, response.Logger}, err
+	return &Page{Document: doc, BaseUrl: baseUrl, Logger: response.Logger, Encoding: response.Encoding, EncodingSource: response.EncodingSource}, err
 }
 
 func (response *Response) Page() (*Page, error) {
@@ -118,24 +184,17 @@ func getCharsetFromHead(document *goquery.Document) string {
 }
 
 func charsetFromContentType(contentType string) string {
-	re := regexp.MustCompile(`.*\bcharset=(.*)`)
+	re := regexp.MustCompile(`(?i).*\bcharset=\s*("[^"]*"|[^;\s]*)`)
 	match := re.FindStringSubmatch(contentType)
 	if len(match) == 2 {
-		return match[1]
+		return strings.Trim(match[1], `"`)
 	}
 	return ""
 }
 
-// getEncodingFromCharset parses charset string and returns encoding.Encoding.
+// getEncodingFromCharset returns encoding.Encoding of a charset label of the WHATWG Encoding Standard.
+// returns nil for UTF-8 or unknown charsets.
 func getEncodingFromCharset(charset string) encoding.Encoding {
-	var e encoding.Encoding
-	switch strings.ToLower(charset) {
-	case "shift_jis", "windows-31j", "x-sjis", "sjis", "cp932", "shift-jis":
-		e = japanese.ShiftJIS
-	case "euc-jp":
-		e = japanese.EUCJP
-	case "iso-2022-jp":
-		e = japanese.ISO2022JP
-	}
+	e, _ := lookupCharset(charset)
 	return e
 }
@@ -0,0 +1,196 @@
+package scraper
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryStatus is the list of HTTP status codes retried when RetryPolicy.RetryStatus is nil.
+var DefaultRetryStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy controls how Session retries transient failures.
+// Transient connection errors (timeouts and connection resets) and responses with one of
+// RetryStatus are retried with exponential backoff. Retry-After response header is honored.
+// Every attempt waits for Session.RateLimiter.
+// Permanent errors such as TooManyRedirectsError or TLS failures are returned immediately.
+type RetryPolicy struct {
+	MaxAttempts        int           // total number of attempts including the first one (<=1 disables retry)
+	InitialBackoff     time.Duration // delay before the first retry (0 = 1 second)
+	MaxBackoff         time.Duration // upper bound of the backoff delay (0 = no limit)
+	Multiplier         float64       // growth factor of the backoff delay (0 = 2)
+	Jitter             float64       // randomization ratio of the backoff delay, 0.0-1.0
+	RetryStatus        []int         // status codes to retry (nil = DefaultRetryStatus)
+	RetryNonIdempotent bool          // retry non-idempotent methods (e.g. POST form submit) too
+}
+
+// retryable reports whether a request with method may be retried by the policy.
+func (policy *RetryPolicy) retryable(method string) bool {
+	if policy.RetryNonIdempotent {
+		return true
+	}
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func (policy *RetryPolicy) retryStatus(statusCode int) bool {
+	statuses := policy.RetryStatus
+	if statuses == nil {
+		statuses = DefaultRetryStatus
+	}
+	return slices.Contains(statuses, statusCode)
+}
+
+// backoff returns the delay before the retry following the attempt-th attempt (1-origin).
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := policy.InitialBackoff
+	if delay == 0 {
+		delay = time.Second
+	}
+	multiplier := policy.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	d := float64(delay)
+	for i := 1; i < attempt; i++ {
+		d *= multiplier
+		if policy.MaxBackoff > 0 && d >= float64(policy.MaxBackoff) {
+			break
+		}
+	}
+	if policy.MaxBackoff > 0 && d > float64(policy.MaxBackoff) {
+		d = float64(policy.MaxBackoff)
+	}
+	if policy.Jitter > 0 {
+		d += d * policy.Jitter * (rand.Float64()*2 - 1)
+	}
+	if d < 0 {
+		d = 0
+	}
+	return time.Duration(d)
+}
+
+// parseRetryAfter parses Retry-After header value (delay-seconds or HTTP-date).
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// do sends req through session.client, retrying transient failures according to session.RetryPolicy.
+// every attempt waits for session.RateLimiter, and the returned function must be called
+// when the response body was consumed to release the limiter.
+func (session *Session) do(req *http.Request) (*http.Response, func(), error) {
+	policy := session.RetryPolicy
+	if policy == nil || policy.MaxAttempts <= 1 || !policy.retryable(req.Method) || (req.Body != nil && req.GetBody == nil) {
+		return session.send(req)
+	}
+
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, func() {}, err
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+
+		response, release, err := session.send(r)
+		if attempt >= policy.MaxAttempts {
+			return response, release, err
+		}
+
+		var delay time.Duration
+		var reason string
+		if err != nil {
+			if ctx.Err() != nil || !transientError(err) {
+				return nil, release, err
+			}
+			delay = policy.backoff(attempt)
+			reason = err.Error()
+		} else {
+			if !policy.retryStatus(response.StatusCode) {
+				return response, release, nil
+			}
+			var ok bool
+			if delay, ok = parseRetryAfter(response.Header.Get("Retry-After"), time.Now()); !ok {
+				delay = policy.backoff(attempt)
+			}
+			reason = response.Status
+			_, _ = io.Copy(io.Discard, response.Body)
+			_ = response.Body.Close()
+		}
+		release()
+
+		session.Printf("%s RETRY %v %v (%d/%d) after %v: %v\n", session.getDebugPrefix(), req.Method, session.Redactor.url(req.URL.String()), attempt+1, policy.MaxAttempts, delay, reason)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, func() {}, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send sends req once after waiting for session.RateLimiter.
+// the limiter is released already if an error is returned.
+func (session *Session) send(req *http.Request) (*http.Response, func(), error) {
+	release, err := session.waitRateLimit(req.Context(), req.URL)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	response, err := session.client.Do(req)
+	if err != nil {
+		release()
+		return nil, func() {}, err
+	}
+	return response, release, nil
+}
+
+// transientError reports whether err of http.Client.Do may succeed by retrying:
+// timeouts, and connections reset or closed by the server.
+// errors of redirect policies, TLS and invalid requests are permanent.
+func transientError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
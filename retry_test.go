@@ -0,0 +1,217 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 350 * time.Millisecond}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 350 * time.Millisecond},
+		{10, 350 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := policy.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%v) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	jittered := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, Jitter: 0.5}
+	for i := 0; i < 20; i++ {
+		if got := jittered.backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("jittered backoff out of range: %v", got)
+		}
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"Mon, 01 Jan 2024 00:00:10 GMT", 10 * time.Second, true},
+		{"Sun, 31 Dec 2023 23:59:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestSession_RetryPolicy(t *testing.T) {
+	newFlakyServer := func(failures int32, status int) (*httptest.Server, *int32) {
+		var count int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&count, 1) <= failures {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(status)
+				fmt.Fprint(w, "error page")
+				return
+			}
+			fmt.Fprintf(w, "<html><body>%v ok</body></html>", r.Method)
+		}))
+		return ts, &count
+	}
+
+	t.Run("GET is retried until success", func(t *testing.T) {
+		ts, count := newFlakyServer(2, http.StatusServiceUnavailable)
+		defer ts.Close()
+
+		dir := t.TempDir()
+		logger := &BufferedLogger{}
+		session := NewSession("retry", logger)
+		session.FilePrefix = dir + "/"
+		session.SaveToFile = true
+		session.RetryPolicy = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+		resp, err := session.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("Get() error: %v", err)
+		}
+		if *count != 3 {
+			t.Errorf("server hit %v times, want 3", *count)
+		}
+		if string(resp.RawBody) != "<html><body>GET ok</body></html>" {
+			t.Errorf("unexpected body %q", resp.RawBody)
+		}
+		if n := strings.Count(logger.String(), "RETRY"); n != 2 {
+			t.Errorf("expected 2 RETRY logs, got %v:\n%v", n, logger.String())
+		}
+
+		// only the final body is recorded, as 1.html
+		saved, err := os.ReadFile(path.Join(dir, "retry", "1.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(saved) != string(resp.RawBody) {
+			t.Errorf("recorded body = %q", saved)
+		}
+		if session.invokeCount != 1 {
+			t.Errorf("invokeCount = %v, want 1", session.invokeCount)
+		}
+	})
+
+	t.Run("gives up after MaxAttempts", func(t *testing.T) {
+		ts, count := newFlakyServer(10, http.StatusTooManyRequests)
+		defer ts.Close()
+
+		session := NewSession("retry", &BufferedLogger{})
+		session.RetryPolicy = &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+
+		_, err := session.Get(ts.URL)
+		if _, ok := err.(ResponseError); !ok {
+			t.Fatalf("expected ResponseError, got %v", err)
+		}
+		if *count != 2 {
+			t.Errorf("server hit %v times, want 2", *count)
+		}
+	})
+
+	t.Run("POST is not retried unless opted in", func(t *testing.T) {
+		ts, count := newFlakyServer(1, http.StatusBadGateway)
+		defer ts.Close()
+
+		session := NewSession("retry", &BufferedLogger{})
+		session.RetryPolicy = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+		form := &Form{url: mustParseURL(t, ts.URL), baseUrl: mustParseURL(t, ts.URL), Method: "post",
+			Elements: map[string]*FormElement{"a": {Type: "text", Name: "a", Value: &AvailableValue{Value: "1"}}},
+			Logger:   &BufferedLogger{}}
+
+		if _, err := session.Submit(form); err == nil {
+			t.Fatal("expected error without RetryNonIdempotent")
+		}
+		if *count != 1 {
+			t.Errorf("server hit %v times, want 1", *count)
+		}
+
+		session.RetryPolicy.RetryNonIdempotent = true
+		atomic.StoreInt32(count, 0)
+		resp, err := session.Submit(form)
+		if err != nil {
+			t.Fatalf("Submit() error: %v", err)
+		}
+		if string(resp.RawBody) != "<html><body>POST ok</body></html>" {
+			t.Errorf("unexpected body %q", resp.RawBody)
+		}
+		if *count != 2 {
+			t.Errorf("server hit %v times, want 2", *count)
+		}
+	})
+
+	t.Run("connection closed by the server is retried", func(t *testing.T) {
+		var count int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&count, 1) == 1 {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err == nil {
+					_ = conn.Close()
+				}
+				return
+			}
+			fmt.Fprint(w, "<html><body>ok</body></html>")
+		}))
+		defer ts.Close()
+
+		session := NewSession("retry", &BufferedLogger{})
+		session.RetryPolicy = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+		if _, err := session.Get(ts.URL); err != nil {
+			t.Fatalf("Get() error: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("server hit %v times, want 2", count)
+		}
+	})
+
+	t.Run("redirect limit is not retried", func(t *testing.T) {
+		var count int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&count, 1)
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		}))
+		defer ts.Close()
+
+		session := NewSession("retry", &BufferedLogger{})
+		session.MaxRedirects = 2
+		session.RetryPolicy = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+		_, err := session.Get(ts.URL)
+		var tooMany TooManyRedirectsError
+		if !errors.As(err, &tooMany) {
+			t.Fatalf("expected TooManyRedirectsError, got %v", err)
+		}
+		if count != 3 {
+			t.Errorf("server hit %v times, want 3 (no retry)", count)
+		}
+	})
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
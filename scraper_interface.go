@@ -56,9 +56,11 @@ type UnifiedScraper interface {
 // UnifiedDownloadOptions provides options for file downloads that work
 // with both HTTP-based and browser-based download mechanisms.
 type UnifiedDownloadOptions struct {
-	Timeout time.Duration // Maximum time to wait for download (defaults to DefaultDownloadTimeout if zero)
-	Glob    string        // File name pattern to match (for Chrome downloads)
-	SaveAs  string        // Target filename (optional)
+	Timeout  time.Duration // Maximum time to wait for download (defaults to DefaultDownloadTimeout if zero)
+	Glob     string        // File name pattern the downloaded file must match (without the sequence number of HTTP downloads)
+	SaveAs   string        // Target filename (optional, HTTP downloads)
+	URL      string        // URL of the resource, relative to the current page for HTTP downloads (optional)
+	Selector string        // Link to follow (href or src for HTTP, clicked for Chrome) if URL is empty (optional)
 }
 
 // ScraperType indicates which underlying scraping mechanism is being used
@@ -1,6 +1,7 @@
 package scraper
 
 import (
+	"context"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	cookiejar "github.com/orirawlings/persistent-cookiejar"
@@ -10,7 +11,10 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -24,21 +28,39 @@ const (
 
 // Session holds communication and logging options
 type Session struct {
-	Name               string // directory name to store session files(downloaded files and cookies)
-	client             http.Client
-	Encoding           encoding.Encoding // force charset over Content-Type response header
-	UserAgent          string            // specify User-Agent
-	FilePrefix         string            // prefix to directory of session files
+	Name      string // directory name to store session files(downloaded files and cookies)
+	client    http.Client
+	Encoding  encoding.Encoding // force charset over Content-Type response header
+	UserAgent string            // specify User-Agent
+	// Header is added to every request, overriding the built-in headers (User-Agent, Accept, etc.).
+	// a header without values removes the built-in one.
+	Header             http.Header
+	FilePrefix         string // prefix to directory of session files
 	invokeCount        int
 	NotUseNetwork      bool // load from previously downloaded session files rather than network access
 	SaveToFile         bool // save downloaded pages to session directory
 	ShowRequestHeader  bool // print request headers with Logger
 	ShowResponseHeader bool // print response headers with Logger
 	ShowFormPosting    bool // print posting form data, with Logger
+	AcceptErrorStatus  bool // return non-2xx responses as *Response instead of ResponseError
+	StopOnRedirect     bool // return a redirect response as *Response instead of following it
+	MaxRedirects       int  // fail with TooManyRedirectsError after following this many redirects (0 = 10)
+	ValidateForm       bool // refuse to submit forms violating HTML5 constraints with FormValidationError
+	SaveCompressedBody bool // save response bodies as received (gzip, br, ...) to session files, unless Redactor is set
 	Log                Logger
 	jar                *cookiejar.Jar
-	BodyFilter         func(resp *Response, body []byte) ([]byte, error)
-	debugStep          string // debug step label for logging
+	BodyFilter         func(resp *Response, body []byte) ([]byte, error) // applied to parsed pages (see BodyFilterHook for every response)
+	Hooks              []Hook                                            // middleware around requests
+	RetryPolicy        *RetryPolicy                                      // retry transient failures (nil = no retry)
+	RateLimiter        *RateLimiter                                      // throttle requests per host (nil = no limit)
+	Cache              *HTTPCache                                        // on-disk cache of GET responses, not used in NotUseNetwork mode (nil = no cache)
+	ReplayMode         ReplayMode                                        // how recorded files are matched with requests in NotUseNetwork mode
+	ReplayIgnoreParams []string                                          // query parameters ignored by ReplayByRequest (e.g. timestamps, nonces)
+	replayIndex        *replayIndex
+	harReplay          *harReplay                                         // replay source loaded by LoadHAR
+	checkRedirectFunc  func(req *http.Request, via []*http.Request) error // SessionOptions.CheckRedirect
+	Redactor           *Redactor                                          // mask secrets in logs and recordings (nil = no masking)
+	debugStep          string                                             // debug step label for logging
 
 	// Fields for unified scraper interface
 	currentPage     *Page             // Current page for unified operations
@@ -55,6 +77,10 @@ func (err RequestError) Error() string {
 	return fmt.Sprintf("%v request error: %v", err.RequestURL.String(), err.Err)
 }
 
+func (err RequestError) Unwrap() error {
+	return err.Err
+}
+
 type ResponseError struct {
 	RequestURL *url.URL
 	Response   *http.Response
@@ -66,7 +92,7 @@ func (err ResponseError) Error() string {
 
 func NewSession(name string, log Logger) *Session {
 	jar, _ := cookiejar.New(nil)
-	return &Session{
+	session := &Session{
 		Name:      name,
 		UserAgent: UserAgent_default,
 		client: http.Client{
@@ -75,6 +101,8 @@ func NewSession(name string, log Logger) *Session {
 		Log: log,
 		jar: jar,
 	}
+	session.client.CheckRedirect = session.checkRedirect
+	return session
 }
 
 func (session *Session) Printf(format string, a ...interface{}) {
@@ -135,56 +163,120 @@ func (session *Session) getDirectory() string {
 	return fmt.Sprintf("%v%v", session.FilePrefix, session.Name)
 }
 
+// makeDirectory creates the session directory if it does not exist.
+func (session *Session) makeDirectory() error {
+	dirname := session.getDirectory()
+	if _, err := os.Stat(dirname); err != nil && os.IsNotExist(err) {
+		if err := os.Mkdir(dirname, os.FileMode(0744)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetDirectory returns the directory path for this session's files
 func (session *Session) GetDirectory() string {
 	return session.getDirectory()
 }
 
+// Rewind resets the request sequence, so that following requests are replayed
+// (or recorded) from the first file of the session directory again.
+func (session *Session) Rewind() {
+	session.invokeCount = 0
+	session.replayIndex = nil
+	if session.harReplay != nil {
+		clear(session.harReplay.used)
+	}
+}
+
 func (session *Session) getHtmlFilename() string {
 	return path.Join(session.getDirectory(), fmt.Sprintf("%v.html", session.invokeCount))
 }
 
+// RequestOption holds per-call options of a request.
+type RequestOption struct {
+	AcceptErrorStatus bool        // return non-2xx responses as *Response instead of ResponseError
+	Header            http.Header // headers of this request, overriding Session.Header (a header without values removes it)
+	StopOnRedirect    bool        // return a redirect response as *Response instead of following it
+	MaxRedirects      int         // overrides Session.MaxRedirects if not 0
+}
+
+// invoke sends req (or loads its recording when NotUseNetwork is set).
+// Cancellation and deadlines of req.Context() are honored in both modes.
 func (session *Session) invoke(req *http.Request) (*Response, error) {
+	return session.invokeOpt(req, RequestOption{})
+}
+
+func (session *Session) invokeOpt(req *http.Request, opt RequestOption) (*Response, error) {
+	if !session.NotUseNetwork {
+		session.setRequestHeader(req, opt)
+	}
+	return session.invokeHooks(req, func(req *http.Request) (*Response, error) {
+		return session.invokeRequest(req, opt)
+	})
+}
+
+func (session *Session) invokeRequest(req *http.Request, opt RequestOption) (*Response, error) {
 	var body []byte
+	var compressedBody []byte
 	var contentType string
+	var coding string // Content-Encoding
+	var statusCode int
+	var header http.Header
+	var redirects []RedirectHop
+
+	if err := req.Context().Err(); err != nil {
+		return nil, RequestError{req.URL, err}
+	}
 
 	if session.NotUseNetwork || session.SaveToFile {
-		dirname := session.getDirectory()
-		if _, err := os.Stat(dirname); err != nil && os.IsNotExist(err) {
-			if err := os.Mkdir(dirname, os.FileMode(0744)); err != nil {
-				return nil, err
-			}
+		if err := session.makeDirectory(); err != nil {
+			return nil, err
+		}
+	}
+
+	var recorded *RecordedRequest
+	if session.SaveToFile || (session.NotUseNetwork && (session.ReplayMode == ReplayByRequest || session.harReplay != nil)) {
+		var err error
+		if recorded, err = newRecordedRequest(req, session.Redactor); err != nil {
+			return nil, RequestError{req.URL, err}
 		}
 	}
 
 	session.invokeCount++
 	filename := session.getHtmlFilename()
+	if session.NotUseNetwork && session.ReplayMode == ReplayByRequest && session.harReplay == nil {
+		var err error
+		if filename, err = session.replayFilename(recorded); err != nil {
+			session.Printf("%s %v\n", session.getDebugPrefix(), err)
+			return nil, err
+		}
+	}
 
 	if session.ShowRequestHeader {
-		session.Printf("REQUEST: %v %v:\n", req.Method, req.URL.String())
+		session.Printf("REQUEST: %v %v:\n", req.Method, session.Redactor.url(req.URL.String()))
 	}
 
 	if !session.NotUseNetwork {
-		userAgent := session.UserAgent
-		if userAgent == "" {
-			userAgent = UserAgent_default
-		}
-		req.Header.Set("User-agent", userAgent)
-		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-		req.Header.Set("Upgrade-Insecure-Requests", "1")
-		req.Header.Set("DNT", "1")
-
 		if session.ShowRequestHeader {
 			session.Printf("Request header:{\n")
-			for k, v := range req.Header {
-				session.Printf("  %v: %v\n", k, v)
-			}
+			session.printHeader(session.Redactor.header(req.Header))
 			session.Printf("}\n")
 
 			//session.Printf("req = %v\n", req)
 		}
 
-		response, err := session.client.Do(req)
+		release := func() {}
+		defer func() {
+			release()
+		}()
+
+		response, err := session.cachedDo(req.WithContext(withRedirectPolicy(req.Context(), session.redirectPolicy(opt))), func(req *http.Request) (*http.Response, error) {
+			var response *http.Response
+			var err error
+			response, release, err = session.do(req)
+			return response, err
+		})
 		if err != nil {
 			return nil, RequestError{req.URL, err}
 		}
@@ -193,16 +285,14 @@ func (session *Session) invoke(req *http.Request) (*Response, error) {
 		}()
 
 		req = response.Request // update req.Url after redirects
-
-		if response.StatusCode/100 != 2 {
-			return nil, ResponseError{req.URL, response}
-		}
+		statusCode = response.StatusCode
+		header = response.Header
+		redirects = redirectChain(response)
 
 		if session.ShowResponseHeader {
+			session.Printf("Response Status: %v\n", response.Status)
 			session.Printf("Response Header:\n")
-			for k, v := range response.Header {
-				session.Printf("  %v: %v\n", k, v)
-			}
+			session.printHeader(session.Redactor.header(response.Header))
 		}
 
 		contentType = response.Header.Get("content-type")
@@ -211,72 +301,209 @@ func (session *Session) invoke(req *http.Request) (*Response, error) {
 		if err != nil {
 			return nil, err
 		}
+		if coding = contentEncoding(header); coding != "" {
+			compressedBody = body
+			if body, err = decodeContent(coding, compressedBody); err != nil {
+				return nil, RequestError{req.URL, err}
+			}
+		}
 
 		if session.SaveToFile {
 			// save to file
-			session.Printf("%s SAVE to %v (%v bytes)\n", session.getDebugPrefix(), filename, len(body))
-			err = os.WriteFile(filename, body, os.FileMode(0644))
+			// the received bytes can not be masked, so Redactor saves the decoded body
+			saveCompressed := session.SaveCompressedBody && compressedBody != nil && session.Redactor == nil
+			saved := session.Redactor.redactBytes(body)
+			if saveCompressed {
+				saved = compressedBody
+			}
+			session.Printf("%s SAVE to %v (%v bytes)\n", session.getDebugPrefix(), filename, len(saved))
+			err = os.WriteFile(filename, saved, os.FileMode(0644))
 			if err != nil {
 				return nil, err
 			}
 
 			// Save metadata to unified file
 			metadata := PageMetadata{
-				URL:         req.URL.String(),
-				ContentType: contentType,
+				Version:         PageMetadataVersion,
+				URL:             req.URL.String(),
+				ContentType:     contentType,
+				StatusCode:      statusCode,
+				Header:          header,
+				Method:          req.Method,
+				RequestHeader:   req.Header,
+				Redirects:       redirects,
+				Request:         recorded,
+				ContentEncoding: coding,
+				CompressedBody:  saveCompressed,
 			}
-			err = savePageMetadata(filename, metadata)
+			err = savePageMetadata(filename, session.Redactor.metadata(metadata))
 			if err != nil {
 				return nil, err
 			}
 		}
+
+		if !session.acceptStatus(statusCode, opt) {
+			return nil, ResponseError{req.URL, response}
+		}
 	} else {
-		// load from file
-		session.Printf("%s LOAD from %v\n", session.getDebugPrefix(), filename)
+		var metadata PageMetadata
 		var err error
-		body, err = os.ReadFile(filename)
-		if err != nil {
-			return nil, RetryAndRecordError{filename}
-		}
+		if session.harReplay != nil {
+			// load from HAR
+			session.Printf("%s LOAD from %v: %v\n", session.getDebugPrefix(), session.harReplay.filename, recorded)
+			body, metadata, err = session.harReplay.lookup(recorded, session.ReplayIgnoreParams, session.Redactor)
+			if err != nil {
+				return nil, ReplayMismatchError{Sequence: session.invokeCount, Request: *recorded}
+			}
+		} else {
+			// load from file
+			session.Printf("%s LOAD from %v\n", session.getDebugPrefix(), filename)
+			body, err = os.ReadFile(filename)
+			if err != nil {
+				return nil, RetryAndRecordError{filename}
+			}
 
-		// Load metadata from unified file
-		metadata, err := loadPageMetadata(filename)
-		if err != nil {
-			return nil, RetryAndRecordError{filename}
+			// Load metadata from unified file
+			metadata, err = loadPageMetadata(filename)
+			if err != nil {
+				return nil, RetryAndRecordError{filename}
+			}
+		}
+		coding = metadata.ContentEncoding
+		if metadata.CompressedBody {
+			compressedBody = body
+			if body, err = decodeContent(coding, compressedBody); err != nil {
+				return nil, RequestError{req.URL, err}
+			}
 		}
 		contentType = metadata.ContentType
+		statusCode = metadata.StatusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK // recorded before status code was saved
+		}
+		header = metadata.Header
+		if header == nil {
+			// recorded before response headers were saved
+			header = http.Header{}
+			if contentType != "" {
+				header.Set("Content-Type", contentType)
+			}
+		}
+		redirects = metadata.Redirects
 
 		// Parse the saved URL and update request URL for proper replay
 		if savedURL, parseErr := url.Parse(metadata.URL); parseErr == nil {
 			req.URL = savedURL
 		}
+		if metadata.Method != "" {
+			req.Method = metadata.Method
+		}
+		if metadata.RequestHeader != nil {
+			req.Header = metadata.RequestHeader
+		}
+
+		if !session.acceptStatus(statusCode, opt) {
+			return nil, ResponseError{req.URL, &http.Response{
+				Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+				StatusCode: statusCode,
+				Header:     header,
+				Request:    req,
+			}}
+		}
 	}
 
 	if session.ShowResponseHeader {
+		session.printRedirects(redirects)
 		session.Printf("Content-type: %v\n", contentType)
 	}
 
 	return &Response{
-		Request:     req,
-		ContentType: contentType,
-		RawBody:     body,
-		Encoding:    session.Encoding,
-		Logger:      session,
+		Request:         req,
+		StatusCode:      statusCode,
+		Header:          header,
+		Redirects:       redirects,
+		ContentType:     contentType,
+		ContentEncoding: coding,
+		RawBody:         body,
+		CompressedBody:  compressedBody,
+		Encoding:        session.Encoding,
+		Logger:          session,
 	}, nil
 }
 
+// setRequestHeader sets the built-in headers, Session.Header and opt.Header to req in this order.
+func (session *Session) setRequestHeader(req *http.Request, opt RequestOption) {
+	userAgent := session.UserAgent
+	if userAgent == "" {
+		userAgent = UserAgent_default
+	}
+	req.Header.Set("User-agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	req.Header.Set("Upgrade-Insecure-Requests", "1")
+	req.Header.Set("DNT", "1")
+	overrideHeader(req.Header, session.Header)
+	overrideHeader(req.Header, opt.Header)
+}
+
+// overrideHeader sets headers in src to dst. a header without values is removed from dst.
+func overrideHeader(dst http.Header, src http.Header) {
+	for k, v := range src {
+		if len(v) == 0 {
+			dst.Del(k)
+		} else {
+			dst[http.CanonicalHeaderKey(k)] = slices.Clone(v)
+		}
+	}
+}
+
+// printHeader prints header sorted by name.
+func (session *Session) printHeader(header http.Header) {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		session.Printf("  %v: %v\n", k, header[k])
+	}
+}
+
+// acceptStatus reports whether a response of statusCode is returned as *Response.
+func (session *Session) acceptStatus(statusCode int, opt RequestOption) bool {
+	if statusCode/100 == 3 && session.redirectPolicy(opt).stop {
+		return true
+	}
+	return statusCode/100 == 2 || session.AcceptErrorStatus || opt.AcceptErrorStatus
+}
+
 // Get invokes HTTP GET request.
 func (session *Session) Get(getUrl string) (*Response, error) {
-	req, err := http.NewRequest("GET", getUrl, nil)
+	return session.GetContext(context.Background(), getUrl)
+}
+
+// GetContext invokes HTTP GET request with ctx.
+func (session *Session) GetContext(ctx context.Context, getUrl string) (*Response, error) {
+	return session.GetOpt(ctx, getUrl, RequestOption{})
+}
+
+// GetOpt invokes HTTP GET request with ctx and per-call options.
+func (session *Session) GetOpt(ctx context.Context, getUrl string, opt RequestOption) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", getUrl, nil)
 	if err != nil {
 		return nil, err
 	}
-	return session.invoke(req)
+	return session.invokeOpt(req, opt)
 }
 
 // GetPageMaxRedirect gets the URL and follows HTTP meta refresh if response page contained that.
 func (session *Session) GetPageMaxRedirect(getUrl string, maxRedirect int) (*Page, error) {
-	resp, err := session.Get(getUrl)
+	return session.GetPageMaxRedirectContext(context.Background(), getUrl, maxRedirect)
+}
+
+// GetPageMaxRedirectContext is GetPageMaxRedirect with ctx.
+func (session *Session) GetPageMaxRedirectContext(ctx context.Context, getUrl string, maxRedirect int) (*Page, error) {
+	resp, err := session.GetContext(ctx, getUrl)
 	if err != nil {
 		return nil, err
 	}
@@ -284,15 +511,20 @@ func (session *Session) GetPageMaxRedirect(getUrl string, maxRedirect int) (*Pag
 	if err != nil {
 		return nil, err
 	}
-	return session.ApplyRefresh(page, maxRedirect)
+	return session.ApplyRefreshContext(ctx, page, maxRedirect)
 }
 
 // ApplyRefresh mimics HTML Meta Refresh.
 func (session *Session) ApplyRefresh(page *Page, maxRedirect int) (*Page, error) {
+	return session.ApplyRefreshContext(context.Background(), page, maxRedirect)
+}
+
+// ApplyRefreshContext is ApplyRefresh with ctx.
+func (session *Session) ApplyRefreshContext(ctx context.Context, page *Page, maxRedirect int) (*Page, error) {
 	if maxRedirect > 0 {
 		if newUrl := page.MetaRefresh(); newUrl != nil {
 			session.Printf("HTML Meta Refresh to: %v\n", newUrl)
-			return session.GetPageMaxRedirect(newUrl.String(), maxRedirect-1)
+			return session.GetPageMaxRedirectContext(ctx, newUrl.String(), maxRedirect-1)
 		}
 	}
 	session.mu.Lock()
@@ -306,6 +538,11 @@ func (session *Session) GetPage(getUrl string) (*Page, error) {
 	return session.GetPageMaxRedirect(getUrl, 1)
 }
 
+// GetPageContext gets the URL with ctx and returns a Page.
+func (session *Session) GetPageContext(ctx context.Context, getUrl string) (*Page, error) {
+	return session.GetPageMaxRedirectContext(ctx, getUrl, 1)
+}
+
 // GetCurrentURL returns the current page URL
 func (session *Session) GetCurrentURL() (string, error) {
 	session.mu.RLock()
@@ -324,6 +561,11 @@ func (session *Session) GetCurrentURL() (string, error) {
 
 // FormAction submits a form (easy version)
 func (session *Session) FormAction(page *Page, formSelector string, params map[string]string) (*Response, error) {
+	return session.FormActionContext(context.Background(), page, formSelector, params)
+}
+
+// FormActionContext is FormAction with ctx.
+func (session *Session) FormActionContext(ctx context.Context, page *Page, formSelector string, params map[string]string) (*Response, error) {
 	form, err := page.Form(formSelector)
 	if err != nil {
 		return nil, err
@@ -336,11 +578,16 @@ func (session *Session) FormAction(page *Page, formSelector string, params map[s
 		}
 	}
 
-	return session.Submit(form)
+	return session.SubmitContext(ctx, form)
 }
 
 // FollowSelectionLink opens a link specified by attr of the selection and returns a Response.
 func (session *Session) FollowSelectionLink(page *Page, selection *goquery.Selection, attr string) (*Response, error) {
+	return session.FollowSelectionLinkContext(context.Background(), page, selection, attr)
+}
+
+// FollowSelectionLinkContext is FollowSelectionLink with ctx.
+func (session *Session) FollowSelectionLinkContext(ctx context.Context, page *Page, selection *goquery.Selection, attr string) (*Response, error) {
 	numLink := selection.Length()
 	if numLink != 1 {
 		return nil, fmt.Errorf("%v: found %v items", page.Url.String(), numLink)
@@ -354,20 +601,35 @@ func (session *Session) FollowSelectionLink(page *Page, selection *goquery.Selec
 	if err != nil {
 		return nil, err
 	}
-	return session.OpenURL(page, reqUrl)
+	return session.OpenURLContext(ctx, page, reqUrl)
 }
 
 // OpenURL invokes HTTP GET request with referer header as page's URL.
 func (session *Session) OpenURL(page *Page, url string) (*Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+	return session.OpenURLContext(context.Background(), page, url)
+}
+
+// OpenURLContext is OpenURL with ctx.
+func (session *Session) OpenURLContext(ctx context.Context, page *Page, url string) (*Response, error) {
+	return session.OpenURLOpt(ctx, page, url, RequestOption{})
+}
+
+// OpenURLOpt is OpenURL with ctx and per-call options.
+func (session *Session) OpenURLOpt(ctx context.Context, page *Page, url string, opt RequestOption) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Referer", page.Url.String())
-	return session.invoke(req)
+	return session.invokeOpt(req, opt)
 }
 
 func (session *Session) FollowLink(page *Page, linkSelector string, attr string) (*Response, error) {
+	return session.FollowLinkContext(context.Background(), page, linkSelector, attr)
+}
+
+// FollowLinkContext is FollowLink with ctx.
+func (session *Session) FollowLinkContext(ctx context.Context, page *Page, linkSelector string, attr string) (*Response, error) {
 	selection := page.Find(linkSelector)
 	numLink := selection.Length()
 	if numLink != 1 {
@@ -377,7 +639,7 @@ func (session *Session) FollowLink(page *Page, linkSelector string, attr string)
 		return nil, fmt.Errorf("%v '%v': missing %v", page.Url.String(), linkSelector, attr)
 	}
 
-	return session.FollowSelectionLink(page, selection, attr)
+	return session.FollowSelectionLinkContext(ctx, page, selection, attr)
 }
 
 // Frame returns a Page of specified frameSelector.
@@ -652,36 +914,65 @@ func (session *Session) ExtractData(v interface{}, selector string, opt Unmarsha
 }
 
 // DownloadResource implements UnifiedScraper.DownloadResource
+// it downloads options.URL, the href (or src) of the element of options.Selector,
+// or the current page itself with Download, and saves the raw bytes as options.SaveAs,
+// the filename of Content-Disposition or a name from the URL.
+// the recorded file is returned in NotUseNetwork mode.
 func (session *Session) DownloadResource(options UnifiedDownloadOptions) (string, error) {
-	// For HTTP scraping, we need to have already followed a download link
-	// This method assumes the current response is a downloadable file
 	if session.currentPage == nil {
 		return "", fmt.Errorf("session: no current page available for download")
 	}
+	if options.Glob != "" {
+		if err := validateDownloadGlob(options.Glob); err != nil {
+			return "", err
+		}
+	}
 
-	// For HTTP downloads, we can try to save the current response if it's a file
-	// This is a basic implementation - more complex scenarios should use direct HTTP methods
-	session.invokeCount++
-	filename := session.getHtmlFilename()
-
-	// Change extension based on content type or SaveAs option
-	if options.SaveAs != "" {
-		filename = path.Join(session.getDirectory(), options.SaveAs)
+	target := session.currentPage.BaseUrl
+	ref := options.URL
+	if ref == "" && options.Selector != "" {
+		selection := session.currentPage.Find(options.Selector).First()
+		if selection.Length() == 0 {
+			return "", fmt.Errorf("session: element not found for download: %v", options.Selector)
+		}
+		var ok bool
+		if ref, ok = selection.Attr("href"); !ok {
+			if ref, ok = selection.Attr("src"); !ok {
+				return "", fmt.Errorf("session: no href or src in %v for download", options.Selector)
+			}
+		}
+	}
+	if ref != "" {
+		var err error
+		if target, err = session.currentPage.BaseUrl.Parse(ref); err != nil {
+			return "", fmt.Errorf("session: invalid download URL %v: %w", ref, err)
+		}
 	}
 
-	// Try to get the raw content (this is a simplified approach)
-	html, err := session.currentPage.Html()
-	if err != nil {
-		return "", fmt.Errorf("session: failed to get page content for download: %w", err)
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = DefaultDownloadTimeout
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	body := []byte(html)
-	err = os.WriteFile(filename, body, 0644)
+	filename, err := session.Download(ctx, target.String(), DownloadOptions{Filename: options.SaveAs})
 	if err != nil {
-		return "", fmt.Errorf("session: failed to save downloaded content: %w", err)
+		return "", fmt.Errorf("session: failed to download resource: %w", err)
+	}
+	if options.Glob != "" {
+		// Glob is for the name from the server, without the sequence number of the saved name
+		name := path.Base(filename)
+		if options.SaveAs == "" {
+			_, name, _ = strings.Cut(name, "-")
+		}
+		if match, _ := filepath.Match(options.Glob, name); !match {
+			if !session.NotUseNetwork {
+				_ = os.Remove(filename)
+			}
+			return "", &DownloadedFileNameNotSatisfiedError{DownloadedFilename: filename, Glob: options.Glob}
+		}
 	}
-
-	session.Printf("%s DOWNLOAD saved to %v (%v bytes)\n", session.getDebugPrefix(), filename, len(body))
 	return filename, nil
 }
 
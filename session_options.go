@@ -0,0 +1,83 @@
+package scraper
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SessionOptions configures the HTTP client of a Session created by NewSessionWithOptions.
+// zero values keep the defaults of http.DefaultTransport.
+type SessionOptions struct {
+	// Transport sends requests instead of a transport built from the options below,
+	// which are ignored if Transport is set.
+	Transport http.RoundTripper
+
+	Proxy     string      // proxy URL (e.g. "http://proxy:8080", "socks5://proxy:1080"); "" uses the environment (HTTP_PROXY etc.)
+	TLSConfig *tls.Config // e.g. RootCAs to pin a CA bundle, Certificates for client certificates
+
+	DialTimeout           time.Duration // timeout of establishing a connection
+	TLSHandshakeTimeout   time.Duration
+	IdleConnTimeout       time.Duration // how long an idle keep-alive connection is kept
+	ResponseHeaderTimeout time.Duration // timeout of waiting response headers after sending a request
+	Timeout               time.Duration // timeout of a whole request including redirects and reading the body (0 = none)
+
+	// CheckRedirect is the redirect policy of http.Client (nil = follow up to 10 redirects).
+	// Session.StopOnRedirect and MaxRedirects are applied before it.
+	CheckRedirect func(req *http.Request, via []*http.Request) error
+}
+
+// NewSessionWithOptions creates a Session like NewSession with the HTTP client configured by options.
+// the cookie jar is set up as NewSession does, and LoadCookie works as well.
+func NewSessionWithOptions(name string, log Logger, options SessionOptions) (*Session, error) {
+	transport, err := options.transport()
+	if err != nil {
+		return nil, err
+	}
+	session := NewSession(name, log)
+	session.client.Transport = transport
+	session.client.Timeout = options.Timeout
+	session.checkRedirectFunc = options.CheckRedirect
+	return session, nil
+}
+
+// transport returns options.Transport or a transport built from the options.
+func (options SessionOptions) transport() (http.RoundTripper, error) {
+	if options.Transport != nil {
+		return options.Transport, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if options.Proxy != "" {
+		proxyURL, err := url.Parse(options.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %v", options.Proxy, err)
+		}
+		if proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q: no host", options.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if options.TLSConfig != nil {
+		transport.TLSClientConfig = options.TLSConfig
+	}
+	if options.DialTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   options.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	if options.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = options.TLSHandshakeTimeout
+	}
+	if options.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = options.IdleConnTimeout
+	}
+	if options.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = options.ResponseHeaderTimeout
+	}
+	return transport, nil
+}
@@ -0,0 +1,130 @@
+package scraper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewSessionWithOptions(t *testing.T) {
+	t.Run("transport keeps cookie jar", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1"})
+			fmt.Fprintf(w, "<html>%v</html>", r.Header.Get("Cookie"))
+		}))
+		defer ts.Close()
+
+		var sent int
+		transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			sent++
+			return http.DefaultTransport.RoundTrip(req)
+		})
+		session, err := NewSessionWithOptions("options", &BufferedLogger{}, SessionOptions{Transport: transport})
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.FilePrefix = t.TempDir() + "/"
+		if _, err := session.Get(ts.URL); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := session.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.RawBody) != "<html>sid=1</html>" || sent != 2 {
+			t.Errorf("body = %s, sent = %v", resp.RawBody, sent)
+		}
+	})
+
+	t.Run("proxy", func(t *testing.T) {
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "<html>proxied %v</html>", r.URL)
+		}))
+		defer proxy.Close()
+
+		session, err := NewSessionWithOptions("options", &BufferedLogger{}, SessionOptions{Proxy: proxy.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.FilePrefix = t.TempDir() + "/"
+		resp, err := session.Get("http://example.invalid/path")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body := string(resp.RawBody); body != "<html>proxied http://example.invalid/path</html>" {
+			t.Errorf("body = %v", body)
+		}
+
+		if _, err := NewSessionWithOptions("options", &BufferedLogger{}, SessionOptions{Proxy: "proxy:8080"}); err == nil {
+			t.Error("proxy without scheme should fail")
+		}
+	})
+
+	t.Run("TLS config", func(t *testing.T) {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "<html>secure</html>")
+		}))
+		defer ts.Close()
+
+		session := NewSession("options", &BufferedLogger{})
+		session.FilePrefix = t.TempDir() + "/"
+		if _, err := session.Get(ts.URL); err == nil {
+			t.Error("unknown CA should fail")
+		}
+
+		pool := x509.NewCertPool()
+		pool.AddCert(ts.Certificate())
+		session, err := NewSessionWithOptions("options", &BufferedLogger{}, SessionOptions{TLSConfig: &tls.Config{RootCAs: pool}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.FilePrefix = t.TempDir() + "/"
+		if _, err := session.Get(ts.URL); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("timeouts and redirect policy", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/slow":
+				time.Sleep(200 * time.Millisecond)
+			case "/redirect":
+				http.Redirect(w, r, "/", http.StatusFound)
+				return
+			}
+			fmt.Fprint(w, "<html></html>")
+		}))
+		defer ts.Close()
+
+		session, err := NewSessionWithOptions("options", &BufferedLogger{}, SessionOptions{
+			ResponseHeaderTimeout: 50 * time.Millisecond,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.FilePrefix = t.TempDir() + "/"
+		if _, err := session.Get(ts.URL + "/slow"); err == nil {
+			t.Error("slow response should time out")
+		}
+		_, err = session.Get(ts.URL + "/redirect")
+		var responseError ResponseError
+		if !errors.As(err, &responseError) || responseError.Response.StatusCode != http.StatusFound {
+			t.Errorf("err = %v", err)
+		}
+	})
+}
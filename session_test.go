@@ -1,6 +1,8 @@
 package scraper
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -8,6 +10,7 @@ import (
 	"path"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestSession_DebugStep(t *testing.T) {
@@ -212,3 +215,267 @@ func TestSession_DebugStep(t *testing.T) {
 		}
 	})
 }
+
+func TestSession_Context(t *testing.T) {
+	t.Run("deadline cancels a hung request", func(t *testing.T) {
+		release := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer ts.Close()
+		defer close(release)
+
+		session := NewSession("test_session", &BufferedLogger{})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := session.GetContext(ctx, ts.URL)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected DeadlineExceeded, got %v", err)
+		}
+		var reqErr RequestError
+		if !errors.As(err, &reqErr) {
+			t.Errorf("expected RequestError, got %T", err)
+		}
+	})
+
+	t.Run("canceled context in replay mode", func(t *testing.T) {
+		dir := t.TempDir()
+		sessionName := "context_replay"
+		if err := os.Mkdir(path.Join(dir, sessionName), 0744); err != nil {
+			t.Fatal(err)
+		}
+		testFile := path.Join(dir, sessionName, "1.html")
+		if err := os.WriteFile(testFile, []byte("<html><body>replay</body></html>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := savePageMetadata(testFile, PageMetadata{URL: "http://example.com", ContentType: "text/html"}); err != nil {
+			t.Fatal(err)
+		}
+
+		session := NewSession(sessionName, &BufferedLogger{})
+		session.FilePrefix = dir + "/"
+		session.NotUseNetwork = true
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := session.GetPageContext(ctx, "http://example.com"); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected Canceled, got %v", err)
+		}
+		if session.invokeCount != 0 {
+			t.Errorf("canceled request must not consume a record number, invokeCount=%v", session.invokeCount)
+		}
+
+		page, err := session.GetPageContext(context.Background(), "http://example.com")
+		if err != nil {
+			t.Fatalf("GetPageContext() error: %v", err)
+		}
+		if got := page.Find("body").Text(); got != "replay" {
+			t.Errorf("body = %q, want %q", got, "replay")
+		}
+	})
+
+	t.Run("SubmitContext passes ctx to the request", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `<html><body><form method="post" action="/post"><input name="a" value="1"></form></body></html>`)
+		}))
+		defer ts.Close()
+
+		session := NewSession("test_session", &BufferedLogger{})
+		page, err := session.GetPage(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := session.FormActionContext(ctx, page, "form", map[string]string{"a": "2"}); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected Canceled, got %v", err)
+		}
+	})
+}
+
+func TestSession_AcceptErrorStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("X-Reason", "maintenance")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<html><body><p id='msg'>under maintenance</p></body></html>")
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	session := NewSession("error_status", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.SaveToFile = true
+
+	// default: ResponseError, but the body is still recorded
+	_, err := session.Get(ts.URL)
+	var respErr ResponseError
+	if !errors.As(err, &respErr) || respErr.Response.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected ResponseError 404, got %v", err)
+	}
+
+	// per-call option
+	resp, err := session.GetOpt(context.Background(), ts.URL, RequestOption{AcceptErrorStatus: true})
+	if err != nil {
+		t.Fatalf("GetOpt() error: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("StatusCode = %v, want 404", resp.StatusCode)
+	}
+	if resp.Header.Get("X-Reason") != "maintenance" {
+		t.Errorf("Header X-Reason = %q", resp.Header.Get("X-Reason"))
+	}
+	page, err := resp.Page()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := page.Find("#msg").Text(); got != "under maintenance" {
+		t.Errorf("#msg = %q", got)
+	}
+
+	metadata, err := loadPageMetadata(path.Join(dir, "error_status", "1.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.StatusCode != http.StatusNotFound {
+		t.Errorf("recorded StatusCode = %v", metadata.StatusCode)
+	}
+
+	// replay reproduces the same results
+	session.NotUseNetwork = true
+	session.invokeCount = 0
+	_, err = session.Get(ts.URL)
+	if !errors.As(err, &respErr) || respErr.Response.StatusCode != http.StatusNotFound {
+		t.Fatalf("replay: expected ResponseError 404, got %v", err)
+	}
+	session.AcceptErrorStatus = true
+	resp, err = session.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("replay: Get() error: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound || !strings.Contains(string(resp.RawBody), "under maintenance") {
+		t.Errorf("replay: StatusCode = %v, body = %q", resp.StatusCode, resp.RawBody)
+	}
+}
+
+func TestSession_RecordResponseMetadata(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "hop", Value: "1"})
+		http.Redirect(w, r, "/final", http.StatusFound)
+	})
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="statement.csv"`)
+		fmt.Fprint(w, "a,b\n1,2\n")
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	session := NewSession("metadata", &BufferedLogger{})
+	session.FilePrefix = dir + "/"
+	session.SaveToFile = true
+
+	check := func(t *testing.T, resp *Response) {
+		t.Helper()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("StatusCode = %v", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Content-Disposition"); got != `attachment; filename="statement.csv"` {
+			t.Errorf("Content-Disposition = %q", got)
+		}
+		if resp.Request.Method != "GET" || resp.Request.URL.String() != ts.URL+"/final" {
+			t.Errorf("Request = %v %v", resp.Request.Method, resp.Request.URL)
+		}
+		if resp.Request.Header.Get("User-agent") == "" {
+			t.Errorf("request headers are missing: %v", resp.Request.Header)
+		}
+		if len(resp.Redirects) != 1 {
+			t.Fatalf("Redirects = %#v", resp.Redirects)
+		}
+		hop := resp.Redirects[0]
+		if hop.URL != ts.URL+"/start" || hop.StatusCode != http.StatusFound || hop.Location() != "/final" {
+			t.Errorf("hop = %#v", hop)
+		}
+		if got := hop.Header.Get("Set-Cookie"); !strings.HasPrefix(got, "hop=1") {
+			t.Errorf("hop Set-Cookie = %q", got)
+		}
+	}
+
+	resp, err := session.Get(ts.URL + "/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, resp)
+
+	session.NotUseNetwork = true
+	session.invokeCount = 0
+	resp, err = session.Get("http://replay.invalid/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, resp)
+}
+
+func TestSession_Header(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	logger := &BufferedLogger{}
+	session := NewSession("header", logger)
+	session.FilePrefix = dir + "/"
+	session.SaveToFile = true
+	session.ShowRequestHeader = true
+	session.Header = http.Header{
+		"Accept-Language":  {"ja"},
+		"X-Requested-With": {"XMLHttpRequest"},
+		"User-Agent":       {"custom-agent"},
+		"Dnt":              nil, // remove the built-in one
+	}
+
+	if _, err := session.Get(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("Accept-Language") != "ja" || got.Get("X-Requested-With") != "XMLHttpRequest" || got.Get("User-Agent") != "custom-agent" {
+		t.Errorf("header = %v", got)
+	}
+	if _, ok := got["Dnt"]; ok {
+		t.Errorf("DNT should be removed: %v", got)
+	}
+	if !strings.Contains(logger.String(), "  Accept-Language: [ja]\n") {
+		t.Errorf("log = %v", logger.String())
+	}
+
+	opt := RequestOption{Header: http.Header{"X-Requested-With": {"fetch"}, "Accept-Language": {}, "X-Api-Key": {"k"}}}
+	if _, err := session.GetOpt(context.Background(), ts.URL, opt); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("X-Requested-With") != "fetch" || got.Get("X-Api-Key") != "k" {
+		t.Errorf("header = %v", got)
+	}
+	if _, ok := got["Accept-Language"]; ok {
+		t.Errorf("Accept-Language should be removed: %v", got)
+	}
+	if session.Header.Get("Accept-Language") != "ja" {
+		t.Error("Session.Header should not be modified")
+	}
+
+	metadata, err := loadPageMetadata(path.Join(dir, "header", "2.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.RequestHeader.Get("X-Api-Key") != "k" || metadata.RequestHeader.Get("User-Agent") != "custom-agent" {
+		t.Errorf("recorded request header = %v", metadata.RequestHeader)
+	}
+}
@@ -25,7 +25,7 @@ func createMashallerTestPage(html string) (*Page, error) {
 		return nil, err
 	}
 
-	page := &Page{doc, testUrl, logger}
+	page := &Page{Document: doc, BaseUrl: testUrl, Logger: logger}
 
 	return page, nil
 }
@@ -0,0 +1,175 @@
+package scraper
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FormConstraints holds HTML5 constraint attributes of a form element.
+type FormConstraints struct {
+	Required  bool
+	MinLength int    // 0 if not specified
+	MaxLength int    // 0 if not specified
+	Pattern   string // "" if not specified
+	Min       string // "" if not specified
+	Max       string // "" if not specified
+	Step      string // "" if not specified, or "any"
+}
+
+// parseFormConstraints reads constraint attributes of s into constraints.
+// for elements sharing a name (e.g. radio buttons), Required of any of them applies.
+func parseFormConstraints(s *goquery.Selection, constraints *FormConstraints) {
+	if _, ok := s.Attr("required"); ok {
+		constraints.Required = true
+	}
+	if n, err := strconv.Atoi(s.AttrOr("minlength", "")); err == nil && n > 0 {
+		constraints.MinLength = n
+	}
+	if n, err := strconv.Atoi(s.AttrOr("maxlength", "")); err == nil && n > 0 {
+		constraints.MaxLength = n
+	}
+	if v, ok := s.Attr("pattern"); ok {
+		constraints.Pattern = v
+	}
+	if v, ok := s.Attr("min"); ok {
+		constraints.Min = v
+	}
+	if v, ok := s.Attr("max"); ok {
+		constraints.Max = v
+	}
+	if v, ok := s.Attr("step"); ok {
+		constraints.Step = v
+	}
+}
+
+// FormViolation is a constraint violated by a form element.
+type FormViolation struct {
+	Name       string // name of the element
+	Constraint string // "required", "minlength", "maxlength", "pattern", "min", "max", "step" or "type"
+	Value      string // the violating value
+	Message    string
+}
+
+func (v FormViolation) String() string {
+	return fmt.Sprintf("%v: %v", v.Name, v.Message)
+}
+
+// Validate checks the values of the form against HTML5 constraint attributes
+// (required, minlength, maxlength, pattern, min, max, step and type of email, url and number).
+// returns violations sorted by element name, or nil if the form is valid.
+func (form *Form) Validate() []FormViolation {
+	names := make([]string, 0, len(form.Elements))
+	for name := range form.Elements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var violations []FormViolation
+	for _, name := range names {
+		violations = append(violations, form.Elements[name].validate()...)
+	}
+	return violations
+}
+
+// empty reports whether the element has no value to submit.
+func (element *FormElement) empty() bool {
+	switch {
+	case element.Type == "file":
+		return len(element.Files) == 0
+	case element.Multiple:
+		return len(element.Values) == 0
+	default:
+		return element.Value == nil || element.Value.Value == ""
+	}
+}
+
+func (element *FormElement) validate() []FormViolation {
+	c := element.Constraints
+	if element.empty() {
+		if c.Required {
+			return []FormViolation{{Name: element.Name, Constraint: "required", Message: "required but empty"}}
+		}
+		return nil
+	}
+	switch element.Type {
+	case "checkbox", "radio", "select", "file", "hidden", "submit", "image", "button":
+		return nil // constraints other than required do not apply
+	}
+
+	value := element.Value.Value
+	violation := func(constraint string, format string, a ...interface{}) FormViolation {
+		return FormViolation{Name: element.Name, Constraint: constraint, Value: value, Message: fmt.Sprintf(format, a...)}
+	}
+	var violations []FormViolation
+
+	length := utf8.RuneCountInString(value)
+	if c.MinLength > 0 && length < c.MinLength {
+		violations = append(violations, violation("minlength", "length %v is shorter than minlength %v", length, c.MinLength))
+	}
+	if c.MaxLength > 0 && length > c.MaxLength {
+		violations = append(violations, violation("maxlength", "length %v is longer than maxlength %v", length, c.MaxLength))
+	}
+	if c.Pattern != "" {
+		// patterns which RE2 can not compile are ignored, like browsers ignore invalid patterns
+		if re, err := regexp.Compile("^(?:" + c.Pattern + ")$"); err == nil && !re.MatchString(value) {
+			violations = append(violations, violation("pattern", "%q does not match pattern %q", value, c.Pattern))
+		}
+	}
+
+	switch strings.ToLower(element.Type) {
+	case "email":
+		if _, err := mail.ParseAddress(value); err != nil || strings.ContainsAny(value, " <>") {
+			violations = append(violations, violation("type", "%q is not an email address", value))
+		}
+	case "url":
+		if u, err := url.Parse(value); err != nil || !u.IsAbs() {
+			violations = append(violations, violation("type", "%q is not an absolute URL", value))
+		}
+	case "number", "range":
+		violations = append(violations, element.validateNumber(value, violation)...)
+	case "date", "month", "week", "time", "datetime-local":
+		// ISO 8601 formats of the same type compare as strings
+		if c.Min != "" && value < c.Min {
+			violations = append(violations, violation("min", "%v is less than min %v", value, c.Min))
+		}
+		if c.Max != "" && value > c.Max {
+			violations = append(violations, violation("max", "%v is greater than max %v", value, c.Max))
+		}
+	}
+	return violations
+}
+
+func (element *FormElement) validateNumber(value string, violation func(constraint string, format string, a ...interface{}) FormViolation) []FormViolation {
+	c := element.Constraints
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return []FormViolation{violation("type", "%q is not a number", value)}
+	}
+	var violations []FormViolation
+	min, minErr := strconv.ParseFloat(c.Min, 64)
+	if minErr == nil && n < min {
+		violations = append(violations, violation("min", "%v is less than min %v", value, c.Min))
+	}
+	if max, err := strconv.ParseFloat(c.Max, 64); err == nil && n > max {
+		violations = append(violations, violation("max", "%v is greater than max %v", value, c.Max))
+	}
+	if step, err := strconv.ParseFloat(c.Step, 64); err == nil && step > 0 {
+		base := 0.0
+		if minErr == nil {
+			base = min
+		}
+		q := (n - base) / step
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			violations = append(violations, violation("step", "%v is not a multiple of step %v from %v", value, c.Step, base))
+		}
+	}
+	return violations
+}
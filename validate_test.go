@@ -0,0 +1,117 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForm_Validate(t *testing.T) {
+	html := `<form>
+<input name='name' required>
+<input name='code' pattern='[A-Z]{3}' value='abc'>
+<input name='short' minlength='3' value='ab'>
+<textarea name='memo' maxlength='4'>あいうえお</textarea>
+<input type='email' name='email' value='not an address'>
+<input type='url' name='site' value='/relative'>
+<input type='number' name='qty' min='1' max='10' step='2' value='4'>
+<input type='number' name='count' value='x'>
+<input type='date' name='day' min='2024-01-01' value='2023-12-31'>
+<input type='radio' name='plan' value='a' required><input type='radio' name='plan' value='b'>
+<input type='checkbox' name='agree' required>
+<select name='pref' required><option value=''>choose</option><option value='1'>one</option></select>
+<input name='optional' pattern='[0-9]+'>
+</form>`
+	form, err := newFormTestPage(t, html).Form("form")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, v := range form.Validate() {
+		got = append(got, v.Name+":"+v.Constraint)
+	}
+	want := []string{
+		"agree:required",
+		"code:pattern",
+		"count:type",
+		"day:min",
+		"email:type",
+		"memo:maxlength",
+		"name:required",
+		"pref:required",
+		"qty:step",
+		"short:minlength",
+		"site:type",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("violations = %v\nwant %v", got, want)
+	}
+
+	for name, value := range map[string]string{"name": "x", "code": "ABC", "short": "abc", "memo": "あいうえ",
+		"email": "user@example.com", "site": "https://example.com/", "qty": "5", "count": "1.5", "day": "2024-01-01"} {
+		if err := form.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := form.Check("agree"); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.Set("pref", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if violations := form.Validate(); violations != nil {
+		t.Errorf("violations = %v", violations)
+	}
+}
+
+func TestSession_ValidateForm(t *testing.T) {
+	posted := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted++
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	html := `<form id='f' method='post'><input name='name' required>
+<button name='save'>Save</button><button name='draft' formnovalidate>Draft</button></form>
+<form id='n' method='post' novalidate><input name='name' required></form>`
+	newForm := func(selector string) *Form {
+		form, err := newFormTestPage(t, html).Form(selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		form.baseUrl = mustParseURL(t, ts.URL)
+		form.url = form.baseUrl
+		return form
+	}
+
+	session := NewSession("validate", &BufferedLogger{})
+	session.FilePrefix = t.TempDir() + "/"
+	session.ValidateForm = true
+
+	_, err := session.Submit(newForm("#f"))
+	var validationError FormValidationError
+	if !errors.As(err, &validationError) || len(validationError.Violations) != 1 {
+		t.Fatalf("err = %v", err)
+	}
+	if posted != 0 {
+		t.Error("invalid form was posted")
+	}
+
+	form := newForm("#f")
+	if err := form.SetSubmitter("draft", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Submit(form); err != nil {
+		t.Errorf("formnovalidate: %v", err)
+	}
+	if _, err := session.Submit(newForm("#n")); err != nil {
+		t.Errorf("novalidate: %v", err)
+	}
+	if posted != 2 {
+		t.Errorf("posted = %v", posted)
+	}
+}